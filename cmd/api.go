@@ -0,0 +1,302 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errors when managing existing gists
+var (
+	errNotFound  = errors.New("Error: gist not found")
+	errRateLimit = errors.New("Error: GitHub API rate limit exceeded")
+)
+
+// remoteGist is the representation of a gist in GitHub's replies
+type remoteGist struct {
+	ID          string                 `json:"id"`
+	URL         string                 `json:"html_url"`
+	Description string                 `json:"description"`
+	Public      bool                   `json:"public"`
+	Owner       *remoteOwner           `json:"owner"`
+	Files       map[string]*remoteFile `json:"files"`
+	History     []*remoteRevision      `json:"history"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// remoteOwner is the account owning a gist
+type remoteOwner struct {
+	Login string `json:"login"`
+}
+
+// remoteFile is a file of a gist. Content is only populated when fetching a
+// single gist, and is cut short when Truncated is set.
+type remoteFile struct {
+	Filename  string `json:"filename"`
+	Language  string `json:"language"`
+	RawURL    string `json:"raw_url"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content"`
+}
+
+// remoteRevision is an entry of a gist's history, most recent first
+type remoteRevision struct {
+	Version     string    `json:"version"`
+	CommittedAt time.Time `json:"committed_at"`
+}
+
+// revision returns the gist's most recent revision, or an empty string if its
+// history was not included in the reply
+func (g *remoteGist) revision() string {
+	if len(g.History) == 0 {
+		return ""
+	}
+	return g.History[0].Version
+}
+
+// filePatch is a file entry of a PATCH request. A nil filePatch in the files
+// map deletes the file.
+type filePatch struct {
+	Content  string `json:"content,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// patchPayload is the structure for PATCH GitHub requests
+type patchPayload struct {
+	Description *string               `json:"description,omitempty"`
+	Files       map[string]*filePatch `json:"files"`
+}
+
+// apiCall sends a request to GitHub's API. A non-nil in is encoded as the JSON
+// body, and a reply with the expected status is decoded into a non-nil out.
+// Any other reply is turned into an error. It returns the response, whose body
+// has been consumed.
+func apiCall(method, path, token string, in, out interface{}, expect int) (*http.Response, error) {
+	if token == "" {
+		return nil, errNoToken
+	}
+
+	var body io.Reader
+	if in != nil {
+		buff := new(bytes.Buffer)
+		if err := json.NewEncoder(buff).Encode(in); err != nil {
+			return nil, err
+		}
+		body = buff
+	}
+	req, err := newRequest(method, path, token, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errNetwork
+	}
+	defer resp.Body.Close()
+
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errBadResponse
+	}
+
+	if resp.StatusCode != expect {
+		return nil, replyError(resp, reply)
+	}
+	if out != nil {
+		if err := json.Unmarshal(reply, out); err != nil {
+			return nil, errBadResponse
+		}
+	}
+	return resp, nil
+}
+
+// replyError turns an unexpected reply from GitHub's API into an error
+func replyError(resp *http.Response, reply []byte) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return errRateLimit
+		}
+		if err := authError(resp); err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return errNotFound
+		}
+	}
+
+	// uncommon error encountered
+	return errors.New(string(reply))
+}
+
+// nextPage returns the API path of the next page of a paginated reply, or an
+// empty string on the last page
+func nextPage(resp *http.Response) string {
+	for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 || strings.TrimSpace(parts[1]) != `rel="next"` {
+			continue
+		}
+		next := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+		if strings.HasPrefix(next, apiURL) {
+			return strings.TrimPrefix(next, apiURL)
+		}
+		if u, err := url.Parse(next); err == nil {
+			return u.RequestURI()
+		}
+	}
+	return ""
+}
+
+// listGists fetches gists from a paginated list endpoint (e.g. /gists or
+// /gists/starred), following pages until limit gists have been read. A limit
+// of zero reads every page. It may return an error.
+func listGists(token, path string, limit int) ([]*remoteGist, error) {
+	var gists []*remoteGist
+	for path != "" {
+		var page []*remoteGist
+		resp, err := apiCall("GET", path, token, nil, &page, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		gists = append(gists, page...)
+		if limit > 0 && len(gists) >= limit {
+			return gists[:limit], nil
+		}
+		path = nextPage(resp)
+	}
+	return gists, nil
+}
+
+// conditionalGet fetches an API path unless it still matches the ETag of a
+// previous reply. It decodes a fresh reply into out, and reports whether the
+// resource was unchanged. It may return an error.
+func conditionalGet(token, path, etag string, out interface{}) (*http.Response, bool, error) {
+	if token == "" {
+		return nil, false, errNoToken
+	}
+	req, err := newRequest("GET", path, token, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, false, errNetwork
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, true, nil
+	}
+
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, errBadResponse
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, replyError(resp, reply)
+	}
+	if err := json.Unmarshal(reply, out); err != nil {
+		return nil, false, errBadResponse
+	}
+	return resp, false, nil
+}
+
+// getGist fetches a gist, including its files' content and history. It may
+// return an error.
+func getGist(token, id string) (*remoteGist, error) {
+	var g remoteGist
+	if _, err := apiCall("GET", "/gists/"+id, token, nil, &g, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// updateGist sends a PATCH request for the gist, returning the updated gist or
+// an error.
+func updateGist(token, id string, patch *patchPayload) (*remoteGist, error) {
+	var g remoteGist
+	if _, err := apiCall("PATCH", "/gists/"+id, token, patch, &g, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// parseGistID extracts a gist ID from an ID or a gist URL (e.g.
+// https://gist.github.com/user/abc123 or its raw and git variants)
+func parseGistID(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if i := strings.IndexAny(arg, "#?"); i >= 0 {
+		arg = arg[:i]
+	}
+	if !strings.Contains(arg, "/") {
+		return arg
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		return arg
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Host == "gist.githubusercontent.com" && len(parts) >= 2 {
+		// raw URLs are /user/id/raw/...
+		return parts[1]
+	}
+	return strings.TrimSuffix(parts[len(parts)-1], ".git")
+}
+
+// getRevision fetches a gist as of a past revision. It may return an error.
+func getRevision(token, id, revision string) (*remoteGist, error) {
+	var g remoteGist
+	if _, err := apiCall("GET", "/gists/"+id+"/"+revision, token, nil, &g, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// content returns the file's full content, downloading it from the raw URL
+// when GitHub truncated it in the reply. It may return an error.
+func (f *remoteFile) content() (string, error) {
+	if !f.Truncated {
+		return f.Content, nil
+	}
+	resp, err := httpClient.Get(f.RawURL)
+	if err != nil {
+		return "", errNetwork
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errBadResponse
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errBadResponse
+	}
+	return string(body), nil
+}
+
+// sortedNames returns the file names of a gist in order
+func sortedNames(files map[string]*remoteFile) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
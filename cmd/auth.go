@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// authStatus describes the identity and capabilities of an API token
+type authStatus struct {
+	Login   string   // account the token belongs to
+	Name    string   // display name of the account
+	Scopes  []string // OAuth scopes granted to the token (classic tokens only)
+	Expires string   // expiry reported by GitHub, "unknown" if unreadable, empty if none
+	SSO     string   // SAML single sign-on enforcement reported by GitHub, if any
+}
+
+// githubUser is used for parsing GitHub's user endpoint reply
+type githubUser struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// checkAuth queries GitHub's user endpoint with the token and reports the
+// token's identity, scopes, expiry and SSO enforcement. It may return an error.
+func checkAuth(token string) (*authStatus, error) {
+	if token == "" {
+		return nil, errNoToken
+	}
+
+	req, err := newRequest("GET", "/user", token, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errNetwork
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		if err := authError(resp); err != nil {
+			return nil, err
+		}
+		return nil, errBadAuth
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errBadResponse
+	}
+	var user githubUser
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, errBadResponse
+	}
+
+	status := &authStatus{
+		Login: user.Login,
+		Name:  user.Name,
+		SSO:   resp.Header.Get("X-GitHub-SSO"),
+	}
+	if expiry, ok := tokenExpiry(resp.Header); ok {
+		status.Expires = expiry.Local().Format("2006-01-02 15:04:05 MST")
+	} else if resp.Header.Get("GitHub-Authentication-Token-Expiration") != "" {
+		status.Expires = "unknown"
+	}
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			status.Scopes = append(status.Scopes, scope)
+		}
+	}
+	return status, nil
+}
+
+// cmdAuthStatus is triggered on auth status command
+func cmdAuthStatus(c *cli.Context) error {
+	token, err := resolveToken(c)
+	if err != nil {
+		return err
+	}
+	status, err := checkAuth(token)
+	if err != nil {
+		return err
+	}
+
+	login := status.Login
+	if status.Name != "" {
+		login += " (" + status.Name + ")"
+	}
+	fmt.Printf("Logged in to %s as %s\n", apiURL, login)
+
+	if len(status.Scopes) > 0 {
+		fmt.Printf("Token scopes: %s\n", strings.Join(status.Scopes, ", "))
+		if !hasGistScope(strings.Join(status.Scopes, ",")) {
+			fmt.Println("Warning: token is missing the gist scope, uploads will fail")
+		}
+	} else {
+		fmt.Println("Token scopes: none reported (fine-grained or OAuth app token)")
+	}
+
+	if status.Expires != "" {
+		fmt.Printf("Token expires: %s\n", status.Expires)
+	} else {
+		fmt.Println("Token expires: never")
+	}
+
+	if status.SSO != "" {
+		fmt.Printf("SAML enforcement: %s\n", status.SSO)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"errors"
+	"net/http"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when selecting the backend of a profile
+var (
+	errBackend     = errors.New("Error: unknown backend in profile (expected github, gitlab, local or paste)")
+	errUnsupported = errors.New("Error: this command is not supported by the profile's backend")
+)
+
+// backend stores gists on a hosting service. Every backend represents its
+// gists as remoteGist, with the full content of their files.
+type backend interface {
+	// create uploads the files as a new gist
+	create(description string, public bool, files []*file) (*remoteGist, error)
+	// get fetches a gist, including its files' content
+	get(id string) (*remoteGist, error)
+	// update applies a patch to a gist, returning the updated gist
+	update(id string, patch *patchPayload) (*remoteGist, error)
+	// remove deletes a gist
+	remove(id string) error
+}
+
+// revisionBackend is a backend serving past revisions of a gist
+type revisionBackend interface {
+	backend
+	// revision fetches a gist as of a past revision
+	revision(id, version string) (*remoteGist, error)
+}
+
+// listBackend is a backend listing the user's gists
+type listBackend interface {
+	backend
+	// list fetches the user's gists, most recent first, stopping once limit
+	// gists have been read (zero reads all). Their files' content may be left
+	// out.
+	list(limit int) ([]*remoteGist, error)
+}
+
+// loadBackend returns the backend selected by the profile, authenticated with
+// the resolved token. GitHub is used when the profile selects none. It may
+// return an error.
+func loadBackend(c *cli.Context) (backend, error) {
+	p, err := loadProfile(c)
+	if err != nil {
+		return nil, err
+	}
+	token, err := resolveToken(c)
+	if err != nil {
+		return nil, err
+	}
+	return newBackend(p, token)
+}
+
+// githubToken returns the resolved token, for commands only GitHub supports
+// (stars, forks, comments and the index). It returns an error when the profile
+// selects another backend.
+func githubToken(c *cli.Context) (string, error) {
+	p, err := loadProfile(c)
+	if err != nil {
+		return "", err
+	}
+	if p.Backend != "" && p.Backend != "github" {
+		return "", errUnsupported
+	}
+	return resolveToken(c)
+}
+
+// newBackend returns the backend selected by a profile, authenticated with the
+// token. It may return an error.
+func newBackend(p *profile, token string) (backend, error) {
+	switch p.Backend {
+	case "", "github":
+		return &githubBackend{token: token}, nil
+	case "gitlab":
+		return newGitLabBackend(p, token)
+	case "local":
+		return newLocalBackend(p)
+	case "paste":
+		return newPasteBackend(p, token)
+	}
+	return nil, errBackend
+}
+
+// githubBackend stores gists on GitHub (or GitHub Enterprise, see apiURL)
+type githubBackend struct {
+	token string
+}
+
+func (b *githubBackend) create(description string, public bool, files []*file) (*remoteGist, error) {
+	payload, err := jsonBuilder(description, public, files)
+	if err != nil {
+		return nil, err
+	}
+	return sendContent(payload, b.token)
+}
+
+func (b *githubBackend) get(id string) (*remoteGist, error) {
+	return getGist(b.token, id)
+}
+
+func (b *githubBackend) update(id string, patch *patchPayload) (*remoteGist, error) {
+	return updateGist(b.token, id, patch)
+}
+
+func (b *githubBackend) list(limit int) ([]*remoteGist, error) {
+	return listGists(b.token, "/gists?per_page=100", limit)
+}
+
+func (b *githubBackend) revision(id, version string) (*remoteGist, error) {
+	return getRevision(b.token, id, version)
+}
+
+func (b *githubBackend) remove(id string) error {
+	_, err := apiCall("DELETE", "/gists/"+id, b.token, nil, nil, http.StatusNoContent)
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/thetannerryan/gist/gisttest"
+)
+
+func TestMain(m *testing.M) {
+	// keep the tests away from the user's configuration and cache
+	dir, err := ioutil.TempDir("", "gist-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	os.Setenv("GIST_CACHE_DIR", dir)
+	os.Setenv("GIST_NO_HTTP_CACHE", "1")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeGitHub starts a fake of the Gist API with a token for octocat, and
+// points the GitHub helpers at it. The returned function restores them and
+// shuts the fake down.
+func fakeGitHub() (*gisttest.Server, string, func()) {
+	srv := gisttest.NewServer()
+	srv.AddToken("test-token", "octocat")
+	previous := apiURL
+	apiURL = srv.URL
+	return srv, "test-token", func() {
+		apiURL = previous
+		srv.Close()
+	}
+}
+
+func TestGitHubBackend(t *testing.T) {
+	srv, token, done := fakeGitHub()
+	defer done()
+	b := &githubBackend{token: token}
+
+	created, err := b.create("notes", false, []*file{
+		{Name: "a.txt", Content: "alpha"},
+		{Name: "b.txt", Content: "beta"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Description != "notes" || created.Public || len(created.Files) != 2 {
+		t.Fatalf("created %+v", created)
+	}
+	stored, ok := srv.Gist(created.ID)
+	if !ok || stored.Owner != "octocat" || stored.Files["b.txt"] != "beta" {
+		t.Fatalf("stored %+v", stored)
+	}
+
+	g, err := b.get(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := remoteFiles(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["a.txt"] != "alpha" {
+		t.Fatalf("fetched files %v", files)
+	}
+
+	updated, err := b.update(created.ID, &patchPayload{Files: map[string]*filePatch{
+		"a.txt": {Content: "changed"},
+		"b.txt": nil,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.revision() == g.revision() || len(updated.Files) != 1 {
+		t.Fatalf("updated %+v", updated)
+	}
+	old, err := b.revision(created.ID, g.revision())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := old.Files["b.txt"]; !ok {
+		t.Fatal("the first revision lost b.txt")
+	}
+
+	if err := b.remove(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.get(created.ID); err != errNotFound {
+		t.Fatalf("get after remove returned %v, want errNotFound", err)
+	}
+}
+
+func TestGitHubTruncatedContent(t *testing.T) {
+	srv, token, done := fakeGitHub()
+	defer done()
+	srv.SetTruncate(4)
+	stored := srv.AddGist("octocat", "", true, map[string]string{"long.txt": "0123456789"})
+
+	g, err := (&githubBackend{token: token}).get(stored.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := remoteFiles(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files["long.txt"] != "0123456789" {
+		t.Fatalf("content %q, want the full file", files["long.txt"])
+	}
+}
+
+func TestListGists(t *testing.T) {
+	srv, token, done := fakeGitHub()
+	defer done()
+	for i := 0; i < 7; i++ {
+		srv.AddGist("octocat", fmt.Sprintf("gist %d", i), i%2 == 0, map[string]string{"a.txt": "a"})
+	}
+	srv.AddGist("hubot", "not mine", true, map[string]string{"a.txt": "a"})
+
+	// every page is followed
+	listed, err := listGists(token, "/gists?per_page=3", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 7 || listed[0].Description != "gist 6" {
+		t.Fatalf("listed %d gists, first %q", len(listed), listed[0].Description)
+	}
+
+	// the limit stops early
+	listed, err = listGists(token, "/gists?per_page=3", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 4 {
+		t.Fatalf("listed %d gists, want 4", len(listed))
+	}
+}
+
+func TestGitHubErrors(t *testing.T) {
+	srv, token, done := fakeGitHub()
+	defer done()
+	srv.AddToken("read-only", "octocat", "repo")
+	upload := []*file{{Name: "a.txt", Content: "a"}}
+
+	if _, err := (&githubBackend{token: "wrong"}).create("", false, upload); err != errBadAuth {
+		t.Errorf("bad token returned %v, want errBadAuth", err)
+	}
+	if _, err := (&githubBackend{token: "read-only"}).create("", false, upload); err != errNoScope {
+		t.Errorf("token without scope returned %v, want errNoScope", err)
+	}
+
+	srv.SetRateLimit(0)
+	if _, err := (&githubBackend{token: token}).get("missing"); err != errRateLimit {
+		t.Errorf("exhausted rate limit returned %v, want errRateLimit", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// cacheStatsName is the file of the HTTP cache holding its counters
+const cacheStatsName = "stats.json"
+
+// httpCache is the transport of httpClient, caching replies to GET requests
+var httpCache = &cacheTransport{base: http.DefaultTransport}
+
+// cacheEntry is a stored reply, revalidated with its ETag or Last-Modified
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	StoredAt     time.Time   `json:"stored_at"`
+}
+
+// cacheStats counts how requests were served by the HTTP cache
+type cacheStats struct {
+	Hits   int `json:"hits"`   // replies served from the cache after a 304
+	Misses int `json:"misses"` // replies fetched in full and stored
+}
+
+// cacheTransport is an on-disk HTTP cache for GET requests. Stored replies are
+// always revalidated with If-None-Match or If-Modified-Since, so the cache never
+// serves stale content, while 304 replies do not count against GitHub's rate
+// limit. Requests that are already conditional are passed through untouched.
+type cacheTransport struct {
+	base http.RoundTripper
+}
+
+// httpCacheDir returns the directory of the HTTP cache. It may return an error.
+func httpCacheDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "http"), nil
+}
+
+// cacheKey identifies a request by its URL and the credentials and media type
+// it was made with, so replies are never shared between tokens
+func cacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Authorization") + "\n" + req.Header.Get("Accept")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" || os.Getenv("GIST_NO_HTTP_CACHE") != "" {
+		return t.base.RoundTrip(req)
+	}
+	dir, err := httpCacheDir()
+	if err != nil {
+		return t.base.RoundTrip(req)
+	}
+	path := filepath.Join(dir, cacheKey(req)+".json")
+
+	// revalidate a stored reply, without modifying the caller's request
+	var entry *cacheEntry
+	if contents, err := ioutil.ReadFile(path); err == nil {
+		var stored cacheEntry
+		if json.Unmarshal(contents, &stored) == nil {
+			entry = &stored
+			revalidate := *req
+			revalidate.Header = make(http.Header)
+			for key, values := range req.Header {
+				revalidate.Header[key] = values
+			}
+			if entry.ETag != "" {
+				revalidate.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				revalidate.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+			req = &revalidate
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		t.count(dir, true)
+		return entry.response(req, resp.Header), nil
+	}
+
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && modified == "") {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	stored := &cacheEntry{
+		URL:          req.URL.String(),
+		Header:       resp.Header,
+		Body:         body,
+		ETag:         etag,
+		LastModified: modified,
+		StoredAt:     time.Now(),
+	}
+	// the cache is best effort, failing to store does not fail the request
+	if contents, err := json.Marshal(stored); err == nil && os.MkdirAll(dir, 0700) == nil {
+		ioutil.WriteFile(path, contents, 0600)
+	}
+	t.count(dir, false)
+	return resp, nil
+}
+
+// response rebuilds a reply from the stored entry, refreshed with the headers
+// of the 304 reply (e.g. rate limit counters)
+func (entry *cacheEntry) response(req *http.Request, fresh http.Header) *http.Response {
+	header := make(http.Header)
+	for key, values := range entry.Header {
+		header[key] = values
+	}
+	for key, values := range fresh {
+		header[key] = values
+	}
+	header.Set("X-Gist-Cache", "hit")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// count records a hit or a miss in the stats file. The file is locked while it
+// is updated, so concurrent gist processes keep each other's counts.
+func (t *cacheTransport) count(dir string, hit bool) {
+	path := filepath.Join(dir, cacheStatsName)
+	unlock, err := lockFile(path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	stats := readCacheStats(path)
+	if hit {
+		stats.Hits++
+	} else {
+		stats.Misses++
+	}
+	// write then rename, so the stats are never read half written
+	if contents, err := json.Marshal(stats); err == nil && ioutil.WriteFile(path+".tmp", contents, 0600) == nil {
+		os.Rename(path+".tmp", path)
+	}
+}
+
+// readCacheStats reads the stats file, yielding zero counters if it is missing
+func readCacheStats(path string) *cacheStats {
+	stats := &cacheStats{}
+	if contents, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(contents, stats)
+	}
+	return stats
+}
+
+// cmdCacheClear is triggered on cache clear command
+func cmdCacheClear(c *cli.Context) error {
+	dir, err := httpCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	fmt.Printf("Cleared HTTP cache in %s\n", dir)
+	return nil
+}
+
+// cmdCacheStats is triggered on cache stats command
+func cmdCacheStats(c *cli.Context) error {
+	dir, err := httpCacheDir()
+	if err != nil {
+		return err
+	}
+
+	entries, size := 0, int64(0)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".json") && info.Name() != cacheStatsName {
+			entries++
+			size += info.Size()
+		}
+	}
+	stats := readCacheStats(filepath.Join(dir, cacheStatsName))
+
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(map[string]interface{}{
+			"directory": dir,
+			"entries":   entries,
+			"bytes":     size,
+			"hits":      stats.Hits,
+			"misses":    stats.Misses,
+		})
+	}
+
+	fmt.Printf("Directory: %s\n", dir)
+	fmt.Printf("Entries:   %d (%.1f KiB)\n", entries, float64(size)/1024)
+	fmt.Printf("Hits:      %d (served from cache, not counted against the rate limit)\n", stats.Hits)
+	fmt.Printf("Misses:    %d\n", stats.Misses)
+	if total := stats.Hits + stats.Misses; total > 0 {
+		fmt.Printf("Hit rate:  %.0f%%\n", 100*float64(stats.Hits)/float64(total))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCacheStatsKeepConcurrentCounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gist-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// separate transports stand for separate gist processes
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			(&cacheTransport{}).count(dir, i%4 == 0)
+		}(i)
+	}
+	wg.Wait()
+
+	stats := readCacheStats(filepath.Join(dir, cacheStatsName))
+	if stats.Hits != 5 || stats.Misses != 15 {
+		t.Fatalf("counted %d hits and %d misses, want 5 and 15", stats.Hits, stats.Misses)
+	}
+}
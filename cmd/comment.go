@@ -0,0 +1,222 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when managing gist comments
+var (
+	errNoCommentID = errors.New("Error: no comment ID has been specified")
+	errNoComment   = errors.New("Error: comment is empty, nothing was sent")
+)
+
+// remoteComment is the representation of a gist comment in GitHub's replies
+type remoteComment struct {
+	ID        int64        `json:"id"`
+	Body      string       `json:"body"`
+	User      *remoteOwner `json:"user"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// commentPayload is the structure for comment POST and PATCH requests
+type commentPayload struct {
+	Body string `json:"body"`
+}
+
+// commentArgs returns the gist ID and, when withComment is set, the comment ID
+// given as the leading arguments, along with the remaining arguments. A missing
+// gist ID or the placeholder picks the gist interactively. It may return an
+// error.
+func commentArgs(c *cli.Context, withComment bool) (string, string, []string, error) {
+	args := c.Args()
+	if withComment && len(args) < 2 {
+		return "", "", nil, errNoCommentID
+	}
+	id, err := gistArg(c, 0)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if !withComment {
+		if len(args) == 0 {
+			return id, "", nil, nil
+		}
+		return id, "", args[1:], nil
+	}
+	return id, strings.TrimPrefix(args[1], "#"), args[2:], nil
+}
+
+// commentBody reads a comment body from the arguments, from stdin when it is
+// piped, or else from the editor (prefilled with initial). It may return an
+// error.
+func commentBody(args []string, initial string) (string, error) {
+	var body string
+	if len(args) > 0 {
+		body = strings.Join(args, " ")
+	} else if stat, err := os.Stdin.Stat(); err == nil && (stat.Mode()&os.ModeCharDevice) == 0 {
+		contents, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		body = string(contents)
+	} else {
+		edited, err := editText("comment.md", initial)
+		if err != nil {
+			return "", err
+		}
+		body = edited
+	}
+	if strings.TrimSpace(body) == "" {
+		return "", errNoComment
+	}
+	return body, nil
+}
+
+// cmdCommentList is triggered on comment list command. It lists the comments
+// of the gist, following pages up to the limit.
+func cmdCommentList(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	id, _, _, err := commentArgs(c, false)
+	if err != nil {
+		return err
+	}
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+
+	comments := []*remoteComment{}
+	limit := c.Int("limit")
+	for path := "/gists/" + id + "/comments?per_page=100"; path != ""; {
+		var page []*remoteComment
+		resp, err := apiCall("GET", path, token, nil, &page, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		comments = append(comments, page...)
+		if limit > 0 && len(comments) >= limit {
+			comments = comments[:limit]
+			break
+		}
+		path = nextPage(resp)
+	}
+
+	if asJSON {
+		return printJSON(comments)
+	}
+	if len(comments) == 0 {
+		fmt.Println("No comments found")
+		return nil
+	}
+	for _, comment := range comments {
+		printComment(comment)
+	}
+	return nil
+}
+
+// printComment prints a comment as text: a header with its ID, author and
+// timestamps, followed by its indented body
+func printComment(comment *remoteComment) {
+	author := "(ghost)"
+	if comment.User != nil {
+		author = comment.User.Login
+	}
+	header := fmt.Sprintf("#%d %s on %s", comment.ID, author, comment.CreatedAt.Local().Format("2006-01-02 15:04"))
+	if comment.UpdatedAt.After(comment.CreatedAt) {
+		header += fmt.Sprintf(" (edited %s)", comment.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Println(header)
+	for _, line := range strings.Split(strings.TrimRight(comment.Body, "\n"), "\n") {
+		fmt.Println("    " + line)
+	}
+	fmt.Println()
+}
+
+// cmdCommentAdd is triggered on comment add command
+func cmdCommentAdd(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	id, _, args, err := commentArgs(c, false)
+	if err != nil {
+		return err
+	}
+	body, err := commentBody(args, "")
+	if err != nil {
+		return err
+	}
+
+	var comment remoteComment
+	if _, err := apiCall("POST", "/gists/"+id+"/comments", token, &commentPayload{Body: body}, &comment, http.StatusCreated); err != nil {
+		return err
+	}
+	fmt.Printf("Added comment #%d\n", comment.ID)
+	return nil
+}
+
+// cmdCommentEdit is triggered on comment edit command. Without a new body, the
+// editor is opened on the current one.
+func cmdCommentEdit(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	id, commentID, args, err := commentArgs(c, true)
+	if err != nil {
+		return err
+	}
+
+	path := "/gists/" + id + "/comments/" + commentID
+	var current remoteComment
+	if _, err := apiCall("GET", path, token, nil, &current, http.StatusOK); err != nil {
+		return err
+	}
+	body, err := commentBody(args, current.Body)
+	if err != nil {
+		return err
+	}
+	if body == current.Body {
+		fmt.Printf("Comment #%s is unchanged\n", commentID)
+		return nil
+	}
+
+	if _, err := apiCall("PATCH", path, token, &commentPayload{Body: body}, nil, http.StatusOK); err != nil {
+		return err
+	}
+	fmt.Printf("Edited comment #%s\n", commentID)
+	return nil
+}
+
+// cmdCommentDelete is triggered on comment delete command
+func cmdCommentDelete(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	id, commentID, _, err := commentArgs(c, true)
+	if err != nil {
+		return err
+	}
+
+	if _, err := apiCall("DELETE", "/gists/"+id+"/comments/"+commentID, token, nil, nil, http.StatusNoContent); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted comment #%s\n", commentID)
+	return nil
+}
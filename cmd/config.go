@@ -0,0 +1,206 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when reading or writing the configuration file
+var (
+	errConfigRead  = errors.New("Error: cannot read configuration file")
+	errConfigWrite = errors.New("Error: cannot write configuration file")
+)
+
+// defaultProfile is the profile used when none is selected
+const defaultProfile = "default"
+
+// config is the persisted configuration, holding one profile per account
+type config struct {
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+// profile holds the stored credentials and settings of a single account
+type profile struct {
+	Token    string `json:"token,omitempty"`     // API token obtained by auth login
+	ClientID string `json:"client_id,omitempty"` // OAuth app used by auth login
+
+	// backend selection, GitHub unless set otherwise
+	Backend          string       `json:"backend,omitempty"`           // github, gitlab, local or paste
+	URL              string       `json:"url,omitempty"`               // GitLab instance (default https://gitlab.com), or paste endpoint template
+	Project          string       `json:"project,omitempty"`           // GitLab project ID or path, for project snippets
+	SecretVisibility string       `json:"secret_visibility,omitempty"` // GitLab visibility of secret uploads (default private)
+	Dir              string       `json:"dir,omitempty"`               // directory of the local backend
+	Paste            *pasteConfig `json:"paste,omitempty"`             // request templates of the paste backend
+
+	// labelling of uploads, Go templates used when no flag is given
+	DescriptionTemplate string `json:"description_template,omitempty"` // default description
+	NameTemplate        string `json:"name_template,omitempty"`        // default file name of public and secret uploads
+
+	Hooks  *hooksConfig `json:"hooks,omitempty"`  // executables run before and after uploads
+	Copy   string       `json:"copy,omitempty"`   // copy uploads to the clipboard: url, raw or markdown
+	Dedupe string       `json:"dedupe,omitempty"` // where identical gists are looked up: history (default), remote or off
+}
+
+// configDir returns the directory holding gist's configuration and state. It
+// honours XDG_CONFIG_HOME, and falls back to the platform's usual location.
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("AppData"); dir != "" {
+			return filepath.Join(dir, appName), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", appName), nil
+}
+
+// cacheDir returns the directory holding gist's caches. It can be overridden
+// with the GIST_CACHE_DIR environment variable.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("GIST_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+// staleLock is the age after which a lock file is taken as left behind by a
+// process that died holding it. Locks are only held while a file is rewritten.
+const staleLock = 10 * time.Second
+
+// lockFile takes the lock on the file at path, shared by every gist process,
+// by creating path.lock. It waits while another process holds it, and returns
+// the function releasing it. It may return an error.
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	lock := path + ".lock"
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lock)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// configPath returns the location of the configuration file. It can be
+// overridden with the GIST_CONFIG environment variable.
+func configPath() (string, error) {
+	if path := os.Getenv("GIST_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// loadConfig reads the configuration file. A missing file yields an empty
+// configuration. It may return an error.
+func loadConfig() (*config, error) {
+	cfg := &config{Profiles: make(map[string]*profile)}
+	path, err := configPath()
+	if err != nil {
+		return nil, errConfigRead
+	}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, errConfigRead
+	}
+	if err := json.Unmarshal(contents, cfg); err != nil {
+		return nil, errConfigRead
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*profile)
+	}
+	return cfg, nil
+}
+
+// save writes the configuration file, readable by the current user only. It
+// may return an error.
+func (cfg *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return errConfigWrite
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errConfigWrite
+	}
+	contents, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return errConfigWrite
+	}
+	if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+		return errConfigWrite
+	}
+	return nil
+}
+
+// profileName returns the profile selected on the command line, or the default
+// profile.
+func profileName(c *cli.Context) string {
+	if name := c.String("profile"); name != "" {
+		return name
+	}
+	return defaultProfile
+}
+
+// loadProfile returns the selected profile, creating an empty one if it does
+// not exist yet. It may return an error.
+func loadProfile(c *cli.Context) (*profile, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := cfg.Profiles[profileName(c)]; ok {
+		return p, nil
+	}
+	return &profile{}, nil
+}
+
+// resolveToken returns the token provided on the command line (or GIST_KEY),
+// falling back to the token stored in the selected profile. It may return an
+// error.
+func resolveToken(c *cli.Context) (string, error) {
+	if token := c.String("token"); token != "" {
+		return token, nil
+	}
+	p, err := loadProfile(c)
+	if err != nil {
+		return "", err
+	}
+	return p.Token, nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+)
+
+// errDedupe is returned when a profile sets an unknown dedupe mode
+var errDedupe = errors.New("Error: unknown dedupe in profile (expected history, remote or off)")
+
+// valid values for the dedupe setting of profiles
+const (
+	dedupeHistory = "history" // gists found in the history of uploads
+	dedupeRemote  = "remote"  // also the user's most recent gists on GitHub
+	dedupeOff     = "off"     // always upload
+)
+
+// dedupeListLimit is the number of the user's most recent gists searched for a
+// duplicate, when the history holds none
+const dedupeListLimit = 100
+
+// fileSetHash returns a hash identifying a set of files by their names and the
+// hashes of their content, regardless of order
+func fileSetHash(hashes map[string]string) string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(hashes[name]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// uploadHashes returns the file names of an upload mapped to the hashes of
+// their content
+func uploadHashes(files []*file) map[string]string {
+	hashes := make(map[string]string, len(files))
+	for _, f := range files {
+		hashes[f.Name] = contentHash(f.Content)
+	}
+	return hashes
+}
+
+// historyCandidates replays the profile's history to find the gists last known
+// to hold the description and file set, most recently changed first. Gists
+// changed in ways the history cannot follow are left out.
+func historyCandidates(profile, description string, public bool, want string) []string {
+	entries, err := loadHistory()
+	if err != nil {
+		return nil
+	}
+	known := make(map[string]map[string]string) // gist ID to file name to hash
+	described := make(map[string]string)        // gist ID to its description
+	changed := make(map[string]int)             // gist ID to its last entry
+	for i, e := range entries {
+		if e.Profile != profile {
+			continue
+		}
+		switch e.Action {
+		case actionUpload:
+			if e.Visibility != visibility(public) {
+				continue
+			}
+			known[e.ID] = make(map[string]string)
+		case actionDelete:
+			delete(known, e.ID)
+			continue
+		}
+		files, ok := known[e.ID]
+		if !ok {
+			continue
+		}
+		described[e.ID] = e.Description
+		for _, f := range e.Files {
+			if f.Deleted {
+				delete(files, f.Name)
+				continue
+			}
+			if f.SHA256 == "" {
+				// a rename, whose content is not recorded
+				files = nil
+				break
+			}
+			files[f.Name] = f.SHA256
+		}
+		if files == nil {
+			delete(known, e.ID)
+			continue
+		}
+		changed[e.ID] = i
+	}
+
+	var candidates []string
+	for id, files := range known {
+		if described[id] == description && fileSetHash(files) == want {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return changed[candidates[i]] > changed[candidates[j]]
+	})
+	return candidates
+}
+
+// sameFiles reports whether a listed gist has the names and sizes of the
+// upload's files, so it is worth fetching to compare content
+func sameFiles(g *remoteGist, files []*file) bool {
+	if len(g.Files) != len(files) {
+		return false
+	}
+	for _, f := range files {
+		listed, ok := g.Files[f.Name]
+		if !ok || listed.Size != len(f.Content) {
+			return false
+		}
+	}
+	return true
+}
+
+// findDuplicate looks for an existing gist of the profile with the same
+// description, visibility and exactly the upload's files. The history of
+// uploads is checked, then with remote the user's most recent gists on GitHub.
+// Candidates are fetched to confirm they still match. Gists that will expire
+// are never reused. It returns nil when there is no duplicate, or when it cannot
+// tell.
+func findDuplicate(profile string, b backend, description string, public bool, files []*file, remote bool) *remoteGist {
+	want := fileSetHash(uploadHashes(files))
+	skip := make(map[string]bool)
+	if records, err := loadExpiries(); err == nil {
+		for _, r := range records {
+			skip[r.ID] = true
+		}
+	}
+
+	// confirm fetches a candidate and checks it holds the files
+	confirm := func(id string) *remoteGist {
+		if skip[id] {
+			return nil
+		}
+		skip[id] = true
+		g, err := b.get(id)
+		if err != nil || g.Public != public || g.Description != description {
+			return nil
+		}
+		contents, err := remoteFiles(g)
+		if err != nil {
+			return nil
+		}
+		hashes := make(map[string]string, len(contents))
+		for name, content := range contents {
+			hashes[name] = contentHash(content)
+		}
+		if fileSetHash(hashes) != want {
+			return nil
+		}
+		return g
+	}
+
+	for _, id := range historyCandidates(profile, description, public, want) {
+		if g := confirm(id); g != nil {
+			return g
+		}
+	}
+
+	github, ok := b.(*githubBackend)
+	if !remote || !ok {
+		return nil
+	}
+	listed, err := listGists(github.token, "/gists?per_page=100", dedupeListLimit)
+	if err != nil {
+		return nil
+	}
+	for _, g := range listed {
+		if g.Public == public && g.Description == description && sameFiles(g, files) {
+			if g := confirm(g.ID); g != nil {
+				return g
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import "testing"
+
+func TestFindDuplicate(t *testing.T) {
+	srv, token, done := fakeGitHub()
+	defer done()
+	b := &githubBackend{token: token}
+	files := []*file{{Name: "report.txt", Content: "all green"}}
+
+	// a gist uploaded elsewhere is only found when searching GitHub
+	remote := srv.AddGist("octocat", "nightly", false, map[string]string{"report.txt": "all green"})
+	if g := findDuplicate("dedupe-remote", b, "nightly", false, files, false); g != nil {
+		t.Fatalf("history only search found %s", g.ID)
+	}
+	if g := findDuplicate("dedupe-remote", b, "nightly", false, files, true); g == nil || g.ID != remote.ID {
+		t.Fatalf("remote search found %+v, want %s", g, remote.ID)
+	}
+	if g := findDuplicate("dedupe-remote", b, "weekly", false, files, true); g != nil {
+		t.Fatalf("search with another description found %s", g.ID)
+	}
+
+	// a gist in the history is found without listing GitHub
+	created, err := b.create("build", true, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logUpload("dedupe-history", "", created, true, files)
+	if g := findDuplicate("dedupe-history", b, "build", true, files, false); g == nil || g.ID != created.ID {
+		t.Fatalf("history search found %+v, want %s", g, created.ID)
+	}
+	for _, tc := range []struct {
+		description string
+		public      bool
+		files       []*file
+	}{
+		{"other build", true, files},
+		{"build", false, files},
+		{"build", true, []*file{{Name: "report.txt", Content: "all red"}}},
+	} {
+		if g := findDuplicate("dedupe-history", b, tc.description, tc.public, tc.files, false); g != nil {
+			t.Errorf("%q (public %t) matched %s", tc.description, tc.public, g.ID)
+		}
+	}
+}
+
+func TestWatchSkipsDuplicates(t *testing.T) {
+	_, token, done := fakeGitHub()
+	defer done()
+	b := &githubBackend{token: token}
+	files := []*file{{Name: "notes.md", Content: "draft"}}
+	opts := &uploadOptions{profile: "dedupe-watch", hooks: &hooksConfig{}, dedupe: dedupeHistory}
+
+	first, err := uploadWith(b, opts, "notes", false, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := uploadWith(b, opts, "notes", false, files); err != nil || again.ID != first.ID {
+		t.Fatalf("upload of the same files returned %+v and %v, want %s", again, err, first.ID)
+	}
+	watched, err := uploadWatched(b, opts, "notes", false, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watched.ID == first.ID {
+		t.Fatalf("watch reused %s from the history", first.ID)
+	}
+}
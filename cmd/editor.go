@@ -0,0 +1,107 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// errEditor is returned when the editor cannot be run or fails
+var errEditor = errors.New("Error: editor exited with an error")
+
+// editorCommand returns the user's editor and its arguments, from VISUAL or
+// EDITOR, falling back to vi (notepad on Windows)
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(env)); len(editor) > 0 {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// runEditor opens the editor on the paths, attached to the terminal, and waits
+// for it to exit. It may return an error.
+func runEditor(paths ...string) error {
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], paths...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errEditor
+	}
+	return nil
+}
+
+// editText opens the editor on a temporary file holding initial, and returns
+// the saved content. The file is named after name, so editors pick the right
+// syntax highlighting. It may return an error.
+func editText(name, initial string) (string, error) {
+	dir, err := ioutil.TempDir("", "gist-edit")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(name))
+	if err := ioutil.WriteFile(path, []byte(initial), 0600); err != nil {
+		return "", err
+	}
+	if err := runEditor(path); err != nil {
+		return "", err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errFileRead
+	}
+	return string(contents), nil
+}
+
+// composeScissors separates the header block from the file when composing an
+// upload in the editor
+const composeScissors = "# ------------------------ >8 ------------------------"
+
+// composeHeader returns the header block prefilling the editor buffer of a new
+// upload, holding the current description
+func composeHeader(description string) string {
+	return "# Edit the description, and write the file below the scissors line. Lines\n" +
+		"# starting with # are ignored above it. Removing the header keeps the\n" +
+		"# description as given, and uploads the whole buffer.\n" +
+		"Description: " + description + "\n" +
+		composeScissors + "\n"
+}
+
+// parseCompose splits an edited buffer into the description and the file
+// content. Without a scissors line, the whole buffer is the content and the
+// description is left as given.
+func parseCompose(buffer, description string) (string, string) {
+	lines := strings.SplitAfter(buffer, "\n")
+	for i, line := range lines {
+		if strings.TrimRight(line, "\r\n") != composeScissors {
+			continue
+		}
+		for _, header := range lines[:i] {
+			header = strings.TrimSpace(header)
+			if strings.HasPrefix(header, "#") {
+				continue
+			}
+			if strings.HasPrefix(strings.ToLower(header), "description:") {
+				description = strings.TrimSpace(header[len("description:"):])
+			}
+		}
+		return description, strings.Join(lines[i+1:], "")
+	}
+	return description, buffer
+}
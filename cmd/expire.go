@@ -0,0 +1,272 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when expiring gists
+var (
+	errExpire       = errors.New("Error: invalid expiry (expected a duration such as 30m, 24h or 7d)")
+	errExpirePaste  = errors.New("Error: the paste backend cannot delete pastes, so they cannot expire")
+	errExpiryRead   = errors.New("Error: cannot read the expiring gists file")
+	errExpiryWrite  = errors.New("Error: cannot write the expiring gists file")
+	errExpiryRecord = errors.New("Error: cannot record the gist's expiry, so it has been deleted")
+	errReapFailures = errors.New("Error: some expired gists could not be deleted, they will be retried on the next reap")
+)
+
+// expiryRecord is a gist to delete once its deadline has passed
+type expiryRecord struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Profile   string    `json:"profile"` // profile the gist was uploaded with
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expiryPath returns the location of the expiring gists file. It may return an
+// error.
+func expiryPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "expiring.json"), nil
+}
+
+// loadExpiries reads the expiring gists. A missing file yields none. It may
+// return an error.
+func loadExpiries() ([]*expiryRecord, error) {
+	path, err := expiryPath()
+	if err != nil {
+		return nil, errExpiryRead
+	}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errExpiryRead
+	}
+	var records []*expiryRecord
+	if err := json.Unmarshal(contents, &records); err != nil {
+		return nil, errExpiryRead
+	}
+	return records, nil
+}
+
+// saveExpiries writes the expiring gists, readable by the current user only.
+// It returns false if the file cannot be written.
+func saveExpiries(records []*expiryRecord) bool {
+	path, err := expiryPath()
+	if err != nil {
+		return false
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false
+	}
+	if records == nil {
+		records = []*expiryRecord{}
+	}
+	contents, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return false
+	}
+	// write then rename, so an interrupted write keeps the previous records
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0600); err != nil {
+		return false
+	}
+	return os.Rename(tmp, path) == nil
+}
+
+// updateExpiries rewrites the expiring gists file with the records returned by
+// edit, given the current ones. The file is locked throughout, so the records
+// written by other gist processes meanwhile are never lost. It may return an
+// error.
+func updateExpiries(edit func([]*expiryRecord) []*expiryRecord) error {
+	path, err := expiryPath()
+	if err != nil {
+		return errExpiryWrite
+	}
+	unlock, err := lockFile(path)
+	if err != nil {
+		return errExpiryWrite
+	}
+	defer unlock()
+	records, err := loadExpiries()
+	if err != nil {
+		return err
+	}
+	if !saveExpiries(edit(records)) {
+		return errExpiryWrite
+	}
+	return nil
+}
+
+// parseExpiry parses the lifetime of a gist: a Go duration (30m, 24h, 1h30m)
+// or a number of days (7d). It may return an error.
+func parseExpiry(value string) (time.Duration, error) {
+	var lifetime time.Duration
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errExpire
+		}
+		lifetime = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, errExpire
+		}
+		lifetime = d
+	}
+	if lifetime <= 0 {
+		return 0, errExpire
+	}
+	return lifetime, nil
+}
+
+// expiryMarker appends the deadline to a description, so readers of the gist
+// know it will go away
+func expiryMarker(description string, deadline time.Time) string {
+	marker := "[expires " + deadline.UTC().Format("2006-01-02 15:04 MST") + "]"
+	if description == "" {
+		return marker
+	}
+	return description + " " + marker
+}
+
+// uploadExpiring uploads the files as a gist that reap deletes once the
+// lifetime has passed. If the expiry cannot be recorded, the gist is deleted
+// rather than left behind. It returns the created gist or an error.
+func uploadExpiring(b backend, profile string, lifetime time.Duration, description string, public bool, files []*file) (*remoteGist, error) {
+	if _, ok := b.(*pasteBackend); ok {
+		return nil, errExpirePaste
+	}
+	// an unreadable file is reported before anything is uploaded
+	if _, err := loadExpiries(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	deadline := now.Add(lifetime)
+	created, err := b.create(expiryMarker(description, deadline), public, files)
+	if err != nil {
+		return nil, err
+	}
+	record := &expiryRecord{
+		ID:        created.ID,
+		URL:       created.URL,
+		Profile:   profile,
+		CreatedAt: now,
+		ExpiresAt: deadline,
+	}
+	err = updateExpiries(func(records []*expiryRecord) []*expiryRecord {
+		return append(records, record)
+	})
+	if err != nil {
+		b.remove(created.ID)
+		return nil, errExpiryRecord
+	}
+	return created, nil
+}
+
+// cmdReap is triggered on reap command. It deletes the gists whose deadline
+// has passed, with the profile each was uploaded with, and prunes their
+// records, leaving those recorded meanwhile. It prints nothing when nothing has expired, so it can run from
+// cron. Failed deletions are reported and retried on the next run.
+func cmdReap(c *cli.Context) error {
+	records, err := loadExpiries()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	backends := make(map[string]backend)
+	backendErrs := make(map[string]error)
+	reaped := make(map[string]bool)
+	failed := 0
+	for _, r := range records {
+		// keep the records of other profiles when one is selected
+		if now.Before(r.ExpiresAt) || (c.String("profile") != "" && r.Profile != c.String("profile")) {
+			continue
+		}
+		if c.Bool("dry-run") {
+			fmt.Printf("Would delete %s (expired %s)\n", r.URL, r.ExpiresAt.Local().Format(time.RFC3339))
+			continue
+		}
+
+		b, ok := backends[r.Profile]
+		if !ok && backendErrs[r.Profile] == nil {
+			p, ok := cfg.Profiles[r.Profile]
+			if !ok {
+				p = &profile{}
+			}
+			token := c.String("token")
+			if token == "" {
+				token = p.Token
+			}
+			if b, err = newBackend(p, token); err != nil {
+				backendErrs[r.Profile] = err
+			} else {
+				backends[r.Profile] = b
+			}
+		}
+		if err := backendErrs[r.Profile]; err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %s\n", r.URL, strings.TrimPrefix(err.Error(), "Error: "))
+			failed++
+			continue
+		}
+
+		switch err := b.remove(r.ID); err {
+		case nil:
+			logDelete(r.Profile, r.ID, r.URL)
+			fmt.Printf("Deleted %s\n", r.URL)
+			reaped[r.ID] = true
+		case errNotFound:
+			fmt.Printf("Already deleted %s\n", r.URL)
+			reaped[r.ID] = true
+		default:
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %s\n", r.URL, strings.TrimPrefix(err.Error(), "Error: "))
+			failed++
+		}
+	}
+
+	// the file is read again, as uploads may have recorded gists meanwhile
+	if len(reaped) > 0 {
+		err := updateExpiries(func(records []*expiryRecord) []*expiryRecord {
+			var kept []*expiryRecord
+			for _, r := range records {
+				if !reaped[r.ID] {
+					kept = append(kept, r)
+				}
+			}
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return errReapFailures
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestUpdateExpiriesKeepsConcurrentRecords(t *testing.T) {
+	if !saveExpiries(nil) {
+		t.Fatal("cannot clear the expiring gists file")
+	}
+	// each update appends one record, as uploads and reaps running at once do
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := updateExpiries(func(records []*expiryRecord) []*expiryRecord {
+				return append(records, &expiryRecord{ID: fmt.Sprintf("gist-%d", i)})
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	records, err := loadExpiries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 20 {
+		t.Fatalf("kept %d records, want 20", len(records))
+	}
+
+	// removing the reaped records leaves the others
+	err = updateExpiries(func(records []*expiryRecord) []*expiryRecord {
+		var kept []*expiryRecord
+		for _, r := range records {
+			if r.ID != "gist-3" {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, _ = loadExpiries(); len(records) != 19 {
+		t.Fatalf("kept %d records, want 19", len(records))
+	}
+}
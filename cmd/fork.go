@@ -0,0 +1,65 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// cmdFork is triggered on fork command. It forks the gist into the token's
+// account and prints the URL of the fork.
+func cmdFork(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	ids, err := gistIDs(c)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return errNoGistID
+	}
+
+	var fork remoteGist
+	if _, err := apiCall("POST", "/gists/"+ids[0]+"/forks", token, nil, &fork, http.StatusCreated); err != nil {
+		return err
+	}
+	fmt.Println(fork.URL)
+	return nil
+}
+
+// cmdForks is triggered on forks command. It lists the forks of the gist with
+// their owner and last update, following pages up to the limit.
+func cmdForks(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	ids, err := gistIDs(c)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return errNoGistID
+	}
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+
+	forks, err := listGists(token, "/gists/"+ids[0]+"/forks?per_page=100", c.Int("limit"))
+	if err != nil {
+		return err
+	}
+	if len(forks) == 0 && !asJSON {
+		fmt.Println("No forks found")
+		return nil
+	}
+	return printGists(c, forks)
+}
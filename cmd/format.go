@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errFormat is returned for unknown output formats
+var errFormat = errors.New("Error: unknown output format (use text or json)")
+
+// jsonOutput reports whether listings should be printed as JSON rather than
+// text, as selected by the format flag. It may return an error.
+func jsonOutput(c *cli.Context) (bool, error) {
+	switch format := strings.ToLower(c.String("format")); format {
+	case "", "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+	return false, errFormat
+}
+
+// printJSON prints v as indented JSON. It may return an error.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// summary is the JSON representation of a gist in listings
+type summary struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Public      bool      `json:"public"`
+	Owner       string    `json:"owner,omitempty"`
+	Files       []string  `json:"files"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// summarize returns the listing representation of a gist
+func summarize(g *remoteGist) *summary {
+	s := &summary{
+		ID:          g.ID,
+		URL:         g.URL,
+		Description: g.Description,
+		Public:      g.Public,
+		Files:       sortedNames(g.Files),
+		UpdatedAt:   g.UpdatedAt,
+	}
+	if g.Owner != nil {
+		s.Owner = g.Owner.Login
+	}
+	return s
+}
+
+// printGists prints a listing of gists, as text or JSON depending on the
+// format flag. It may return an error.
+func printGists(c *cli.Context, gists []*remoteGist) error {
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+	summaries := make([]*summary, 0, len(gists))
+	for _, g := range gists {
+		summaries = append(summaries, summarize(g))
+	}
+	if asJSON {
+		return printJSON(summaries)
+	}
+	for _, s := range summaries {
+		printSummary(s)
+	}
+	return nil
+}
+
+// printSummary prints a gist as text: its URL and description, followed by an
+// indented line describing its files and last update
+func printSummary(s *summary) {
+	description := s.Description
+	if description == "" {
+		description = "(no description)"
+	}
+	visibility := "secret"
+	if s.Public {
+		visibility = "public"
+	}
+	fmt.Printf("%s  %s\n", s.URL, description)
+	details := []string{visibility, "updated " + s.UpdatedAt.Local().Format("2006-01-02 15:04")}
+	if s.Owner != "" {
+		details = append([]string{"by " + s.Owner}, details...)
+	}
+	fmt.Printf("    %s (%s)\n", strings.Join(s.Files, ", "), strings.Join(details, ", "))
+}
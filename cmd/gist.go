@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/atotto/clipboard" // Copyright (c) 2013 Ato Araki. All rights reserved.
 	"gopkg.in/urfave/cli.v1"      // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
@@ -25,14 +26,16 @@ const (
 )
 
 var (
-	httpClient      = &http.Client{} // HTTP client for sending requests
-	fileNames       = ""             // string to possibly be populated for file name overrides
-	gistDescription = ""             // string to possibly be populated with gist description
+	httpClient      = &http.Client{Transport: httpCache} // HTTP client for sending requests
+	fileNames       = ""                                 // string to possibly be populated for file name overrides
+	gistDescription = ""                                 // string to possibly be populated with gist description
 	errNoData       = errors.New("Error: no input data has been specified")
 	errExtraNames   = errors.New("Error: more override file names than inputs have been provided")
 	errFileRead     = errors.New("Error: cannot read all files")
 	errClipboard    = errors.New("Error: cannot read data from clipboard")
 	errCopyToken    = errors.New("Error: the clipboard is populated with the API token")
+	errEditorArgs   = errors.New("Error: files cannot be provided when composing in the editor")
+	errEmptyEdit    = errors.New("Error: the file is empty, nothing was uploaded")
 )
 
 // Run is the main entrypoint for gist.
@@ -40,16 +43,52 @@ func Run() error {
 	app := cli.NewApp()
 	setup(app)
 
+	tokenFlag := cli.StringFlag{
+		Name:   "token, t",
+		Usage:  "GitHub Gist access token (defaults to the profile's stored login)",
+		EnvVar: "GIST_KEY",
+	}
+	profileFlag := cli.StringFlag{
+		Name:   "profile",
+		Usage:  "configuration profile to use (default \"default\")",
+		EnvVar: "GIST_PROFILE",
+	}
+	expireFlag := cli.StringFlag{
+		Name:  "expire",
+		Usage: "delete the gist after this long (e.g. 30m, 24h or 7d) when reap runs",
+	}
+	forceNewFlag := cli.BoolFlag{
+		Name:  "force-new",
+		Usage: "upload even if an identical gist already exists",
+	}
+	copyFlag := cli.BoolFlag{
+		Name:  "copy",
+		Usage: "copy the gist's URL to the clipboard",
+	}
+	copyAsFlag := cli.StringFlag{
+		Name:  "copy-as",
+		Usage: "copy the URL, raw URL or a markdown link: url, raw, markdown or none (default the profile's copy)",
+	}
+	outputFileFlag := cli.StringFlag{
+		Name:  "output-file",
+		Usage: "file to append the gist's URL to",
+	}
 	flags := []cli.Flag{
-		cli.StringFlag{
-			Name:   "token, t",
-			Usage:  "required GitHub Gist access token",
-			EnvVar: "GIST_KEY",
-		},
+		tokenFlag,
+		profileFlag,
+		expireFlag,
+		forceNewFlag,
+		copyFlag,
+		copyAsFlag,
+		outputFileFlag,
 		cli.BoolFlag{
 			Name:  "clipboard, c",
 			Usage: "read from clipboard",
 		},
+		cli.BoolFlag{
+			Name:  "editor, e",
+			Usage: "compose the file (and description) in $VISUAL or $EDITOR",
+		},
 		cli.StringFlag{
 			Name:        "name, n",
 			Usage:       "comma separated file name override for Gist",
@@ -60,6 +99,38 @@ func Run() error {
 			Usage:       "gist description",
 			Destination: &gistDescription,
 		},
+		cli.BoolFlag{
+			Name:  "watch, w",
+			Usage: "keep the gist in sync with the files until interrupted",
+		},
+	}
+	formatFlag := cli.StringFlag{
+		Name:  "format, f",
+		Usage: "output format: text or json",
+		Value: "text",
+	}
+	limitFlag := cli.IntFlag{
+		Name:  "limit",
+		Usage: "maximum number of entries to list, following pages (0 for all)",
+		Value: 30,
+	}
+	gitFlags := []cli.Flag{
+		tokenFlag,
+		profileFlag,
+		expireFlag,
+		forceNewFlag,
+		copyFlag,
+		copyAsFlag,
+		outputFileFlag,
+		cli.StringFlag{
+			Name:        "description, d",
+			Usage:       "gist description (defaults to the repository, branch and HEAD)",
+			Destination: &gistDescription,
+		},
+		cli.BoolFlag{
+			Name:  "public",
+			Usage: "upload as a public gist",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
@@ -82,6 +153,465 @@ func Run() error {
 			},
 			Flags: flags,
 		},
+		{
+			Name:      "run",
+			Aliases:   []string{"r"},
+			Usage:     "run a command and upload its output as a secret gist",
+			ArgsUsage: "[--] command [arguments...]",
+			Action: func(c *cli.Context) error {
+				// execute run
+				return cmdRun(c)
+			},
+			Flags: []cli.Flag{
+				tokenFlag,
+				profileFlag,
+				expireFlag,
+				forceNewFlag,
+				copyFlag,
+				copyAsFlag,
+				outputFileFlag,
+				cli.StringFlag{
+					Name:        "description, d",
+					Usage:       "gist description (defaults to the command line)",
+					Destination: &gistDescription,
+				},
+				cli.BoolFlag{
+					Name:  "interleave, i",
+					Usage: "capture stdout and stderr into a single file",
+				},
+				cli.BoolFlag{
+					Name:  "public",
+					Usage: "upload as a public gist",
+				},
+			},
+			SkipArgReorder: true,
+		},
+		{
+			Name:      "record",
+			Usage:     "record a terminal session and upload it as an asciicast",
+			ArgsUsage: "[command [arguments...]]",
+			Action: func(c *cli.Context) error {
+				// execute record
+				return cmdRecord(c)
+			},
+			Flags: []cli.Flag{
+				tokenFlag,
+				profileFlag,
+				expireFlag,
+				forceNewFlag,
+				copyFlag,
+				copyAsFlag,
+				outputFileFlag,
+				cli.StringFlag{
+					Name:        "description, d",
+					Usage:       "gist description (defaults to the shell and date)",
+					Destination: &gistDescription,
+				},
+				cli.BoolFlag{
+					Name:  "keep-ansi",
+					Usage: "keep escape sequences in the plain-text transcript",
+				},
+				cli.BoolFlag{
+					Name:  "public",
+					Usage: "upload as a public gist",
+				},
+			},
+			SkipArgReorder: true,
+		},
+		{
+			Name:  "git",
+			Usage: "upload diffs, patches and changed files from the current git repository",
+			Subcommands: []cli.Command{
+				{
+					Name:      "diff",
+					Usage:     "upload the working tree diff",
+					ArgsUsage: "[paths...]",
+					Action: func(c *cli.Context) error {
+						// execute git diff
+						return cmdGitDiff(c, false)
+					},
+					Flags: gitFlags,
+				},
+				{
+					Name:      "staged",
+					Usage:     "upload the staged diff",
+					ArgsUsage: "[paths...]",
+					Action: func(c *cli.Context) error {
+						// execute git staged
+						return cmdGitDiff(c, true)
+					},
+					Flags: gitFlags,
+				},
+				{
+					Name:      "range",
+					Usage:     "upload a commit range as format-patch output",
+					ArgsUsage: "<revision range>",
+					Action: func(c *cli.Context) error {
+						// execute git range
+						return cmdGitRange(c)
+					},
+					Flags: gitFlags,
+				},
+				{
+					Name:      "files",
+					Usage:     "upload the files changed in a commit",
+					ArgsUsage: "<commit>",
+					Action: func(c *cli.Context) error {
+						// execute git files
+						return cmdGitFiles(c)
+					},
+					Flags: gitFlags,
+				},
+			},
+		},
+		{
+			Name:      "sync",
+			Usage:     "two-way sync a directory bound to a gist",
+			ArgsUsage: "[directory]",
+			Action: func(c *cli.Context) error {
+				// execute sync
+				return cmdSync(c)
+			},
+			Flags: []cli.Flag{
+				tokenFlag,
+				profileFlag,
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "only print what would be pushed and pulled",
+				},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:      "init",
+					Usage:     "bind a directory to a gist and download its files",
+					ArgsUsage: "<gist ID or URL> [directory]",
+					Action: func(c *cli.Context) error {
+						// execute sync init
+						return cmdSyncInit(c)
+					},
+					Flags: []cli.Flag{tokenFlag, profileFlag},
+				},
+			},
+		},
+		{
+			Name:      "open",
+			Usage:     "edit a gist's files in $VISUAL or $EDITOR and push back the changes",
+			ArgsUsage: "<gist ID or URL>",
+			Action: func(c *cli.Context) error {
+				// execute open
+				return cmdOpen(c)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag},
+		},
+		{
+			Name:      "star",
+			Usage:     "star one or more gists",
+			ArgsUsage: "<gist ID or URL...>",
+			Action: func(c *cli.Context) error {
+				// execute star
+				return cmdStar(c, true)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag},
+		},
+		{
+			Name:      "unstar",
+			Usage:     "unstar one or more gists",
+			ArgsUsage: "<gist ID or URL...>",
+			Action: func(c *cli.Context) error {
+				// execute unstar
+				return cmdStar(c, false)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag},
+		},
+		{
+			Name:  "starred",
+			Usage: "list your starred gists",
+			Action: func(c *cli.Context) error {
+				// execute starred
+				return cmdStarred(c)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag, formatFlag, limitFlag},
+		},
+		{
+			Name:      "is-starred",
+			Usage:     "check whether a gist is starred (exits 1 if not)",
+			ArgsUsage: "<gist ID or URL>",
+			Action: func(c *cli.Context) error {
+				// execute is-starred
+				return cmdIsStarred(c)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag, formatFlag},
+		},
+		{
+			Name:      "fork",
+			Usage:     "fork a gist into your account",
+			ArgsUsage: "<gist ID or URL>",
+			Action: func(c *cli.Context) error {
+				// execute fork
+				return cmdFork(c)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag},
+		},
+		{
+			Name:      "forks",
+			Usage:     "list the forks of a gist",
+			ArgsUsage: "<gist ID or URL>",
+			Action: func(c *cli.Context) error {
+				// execute forks
+				return cmdForks(c)
+			},
+			Flags: []cli.Flag{tokenFlag, profileFlag, formatFlag, limitFlag},
+		},
+		{
+			Name:  "comment",
+			Usage: "list, add, edit and delete gist comments",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					Usage:     "list the comments of a gist",
+					ArgsUsage: "<gist ID or URL>",
+					Action: func(c *cli.Context) error {
+						// execute comment list
+						return cmdCommentList(c)
+					},
+					Flags: []cli.Flag{tokenFlag, profileFlag, formatFlag, limitFlag},
+				},
+				{
+					Name:      "add",
+					Usage:     "comment on a gist (from arguments, stdin or the editor)",
+					ArgsUsage: "<gist ID or URL> [text...]",
+					Action: func(c *cli.Context) error {
+						// execute comment add
+						return cmdCommentAdd(c)
+					},
+					Flags: []cli.Flag{tokenFlag, profileFlag},
+				},
+				{
+					Name:      "edit",
+					Usage:     "edit a comment (from arguments, stdin or the editor)",
+					ArgsUsage: "<gist ID or URL> <comment ID> [text...]",
+					Action: func(c *cli.Context) error {
+						// execute comment edit
+						return cmdCommentEdit(c)
+					},
+					Flags: []cli.Flag{tokenFlag, profileFlag},
+				},
+				{
+					Name:      "delete",
+					Usage:     "delete a comment",
+					ArgsUsage: "<gist ID or URL> <comment ID>",
+					Action: func(c *cli.Context) error {
+						// execute comment delete
+						return cmdCommentDelete(c)
+					},
+					Flags: []cli.Flag{tokenFlag, profileFlag},
+				},
+			},
+		},
+		{
+			Name:  "serve",
+			Usage: "run an HTTP gateway that uploads on behalf of clients holding an API key",
+			Action: func(c *cli.Context) error {
+				// execute serve
+				return cmdServe(c)
+			},
+			Flags: []cli.Flag{
+				tokenFlag,
+				profileFlag,
+				cli.StringFlag{
+					Name:  "listen",
+					Usage: "address to listen on",
+					Value: "127.0.0.1:8080",
+				},
+				cli.StringFlag{
+					Name:   "keys",
+					Usage:  "JSON file of client names to their API key (and allow_public)",
+					EnvVar: "GIST_SERVE_KEYS",
+				},
+				cli.Int64Flag{
+					Name:  "max-size",
+					Usage: "maximum size of a request body in bytes",
+					Value: 1 << 20,
+				},
+				cli.BoolFlag{
+					Name:  "allow-public",
+					Usage: "let every client upload public gists",
+				},
+				cli.StringFlag{
+					Name:  "access-log",
+					Usage: "file to append the access log to (default stderr)",
+				},
+				expireFlag,
+			},
+		},
+		{
+			Name:  "reap",
+			Usage: "delete the gists uploaded with --expire whose time is up",
+			Action: func(c *cli.Context) error {
+				// execute reap
+				return cmdReap(c)
+			},
+			Flags: []cli.Flag{
+				tokenFlag,
+				cli.StringFlag{
+					Name:   "profile",
+					Usage:  "only reap the gists uploaded with this profile (default all)",
+					EnvVar: "GIST_PROFILE",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "only print the gists that would be deleted",
+				},
+			},
+		},
+		{
+			Name:  "log",
+			Usage: "show the history of gists uploaded, updated and deleted from this machine",
+			Action: func(c *cli.Context) error {
+				// execute log
+				return cmdLog(c)
+			},
+			Flags: []cli.Flag{
+				formatFlag,
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "maximum number of entries, most recent first (0 for all)",
+					Value: 30,
+				},
+				cli.StringFlag{
+					Name:  "id",
+					Usage: "only show the entries of this gist ID or URL",
+				},
+				cli.StringFlag{
+					Name:  "action",
+					Usage: "only show uploads, updates or deletions: upload, update or delete",
+				},
+				cli.StringFlag{
+					Name:  "profile",
+					Usage: "only show the entries of this profile (default all)",
+				},
+				cli.StringFlag{
+					Name:  "visibility",
+					Usage: "only show public or secret gists",
+				},
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "only show entries with a file name or source path containing this",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only show entries from this date (2019-06-01) or duration ago (24h, 7d)",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only show entries before this date or duration ago",
+				},
+			},
+		},
+		{
+			Name:    "index",
+			Aliases: []string{"fetch"},
+			Usage:   "fetch your gists into the local index for offline search",
+			Action: func(c *cli.Context) error {
+				// execute index
+				return cmdIndex(c)
+			},
+			Flags: []cli.Flag{
+				tokenFlag,
+				profileFlag,
+				cli.BoolFlag{
+					Name:  "full",
+					Usage: "refetch the whole listing, pruning deleted gists",
+				},
+			},
+		},
+		{
+			Name:      "search",
+			Usage:     "search the local index offline",
+			ArgsUsage: "<terms...>",
+			Action: func(c *cli.Context) error {
+				// execute search
+				return cmdSearch(c)
+			},
+			Flags: []cli.Flag{
+				profileFlag,
+				formatFlag,
+				cli.StringFlag{
+					Name:  "in",
+					Usage: "comma separated fields to search: description, files, content",
+					Value: "description,files,content",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "maximum number of results (0 for all)",
+					Value: 20,
+				},
+			},
+		},
+		{
+			Name:  "cache",
+			Usage: "manage the on-disk HTTP cache",
+			Subcommands: []cli.Command{
+				{
+					Name:  "clear",
+					Usage: "remove every cached reply",
+					Action: func(c *cli.Context) error {
+						// execute cache clear
+						return cmdCacheClear(c)
+					},
+				},
+				{
+					Name:  "stats",
+					Usage: "show the size and hit rate of the cache",
+					Action: func(c *cli.Context) error {
+						// execute cache stats
+						return cmdCacheStats(c)
+					},
+					Flags: []cli.Flag{formatFlag},
+				},
+			},
+		},
+		{
+			Name:    "auth",
+			Aliases: []string{"a"},
+			Usage:   "log in to GitHub and inspect the API token",
+			Subcommands: []cli.Command{
+				{
+					Name:  "status",
+					Usage: "show the login, scopes and expiry of the API token",
+					Action: func(c *cli.Context) error {
+						// execute auth status
+						return cmdAuthStatus(c)
+					},
+					Flags: []cli.Flag{tokenFlag, profileFlag},
+				},
+				{
+					Name:  "login",
+					Usage: "obtain and store a token with the OAuth device flow",
+					Action: func(c *cli.Context) error {
+						// execute auth login
+						return cmdAuthLogin(c)
+					},
+					Flags: []cli.Flag{
+						profileFlag,
+						cli.StringFlag{
+							Name:   "client-id",
+							Usage:  "client ID of the OAuth app to authorize (stored in the profile)",
+							EnvVar: "GIST_CLIENT_ID",
+						},
+					},
+				},
+				{
+					Name:  "logout",
+					Usage: "remove the token stored in the profile",
+					Action: func(c *cli.Context) error {
+						// execute auth logout
+						return cmdAuthLogout(c)
+					},
+					Flags: []cli.Flag{profileFlag},
+				},
+			},
+		},
 		{
 			Name:    "license",
 			Aliases: []string{"l"},
@@ -116,7 +646,8 @@ func cmdExec(c *cli.Context, public bool) error {
 	var files []*file
 
 	// determine input mode
-	switch mode := checkInputMode(c.Args(), c.Bool("clipboard")); mode {
+	mode := checkInputMode(c.Args(), c.Bool("clipboard"), c.Bool("editor"))
+	switch mode {
 	case modeStdin:
 		if err := execStdin(c, overwrittenNames, &files); err != nil {
 			return err
@@ -129,22 +660,135 @@ func cmdExec(c *cli.Context, public bool) error {
 		if err := execClipboard(c, overwrittenNames, &files); err != nil {
 			return err
 		}
+	case modeEditor:
+		if err := execEditor(c, overwrittenNames, &files); err != nil {
+			return err
+		}
 	default:
 		return errNoData
 	}
 
-	// build payload, send request, print url or return error
-	payload, err := jsonBuilder(gistDescription, public, files)
+	description, err := describe(c, "", "", files)
+	if err != nil {
+		return err
+	}
+	if c.Bool("watch") {
+		if mode != modeGlobs {
+			return errWatchInput
+		}
+		return watch(c, description, public, files)
+	}
+	return publish(c, description, public, files)
+}
+
+// publish uploads the files and prints the resulting URL, also sending it to
+// the output file and clipboard if set. It may return an error.
+func publish(c *cli.Context, description string, public bool, files []*file) error {
+	sinks, err := newOutputSinks(c)
 	if err != nil {
 		return err
 	}
-	url, err := sendContent(payload, c.String("token"))
+	created, err := upload(c, description, public, files)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(url)
-	return nil
+	return sinks.report(created)
+}
+
+// uploadOptions are the settings of an upload besides its content
+type uploadOptions struct {
+	profile  string        // name of the profile uploaded with
+	client   string        // gateway client uploading, if any
+	hooks    *hooksConfig  // hooks run before and after the upload
+	lifetime time.Duration // lifetime of an expiring gist, or zero
+	dedupe   string        // where an identical gist is looked up: history, remote or off
+}
+
+// newUploadOptions returns the settings of an upload from the profile and the
+// --expire and --force-new flags. With --expire, the gist is never
+// deduplicated. It may return an error.
+func newUploadOptions(c *cli.Context) (*uploadOptions, error) {
+	p, err := loadProfile(c)
+	if err != nil {
+		return nil, err
+	}
+	opts := &uploadOptions{profile: profileName(c), hooks: p.Hooks, dedupe: p.Dedupe}
+	if opts.hooks == nil {
+		opts.hooks = &hooksConfig{}
+	}
+	switch opts.dedupe {
+	case "":
+		opts.dedupe = dedupeHistory
+	case dedupeHistory, dedupeRemote, dedupeOff:
+	default:
+		return nil, errDedupe
+	}
+	if c.Bool("force-new") {
+		opts.dedupe = dedupeOff
+	}
+	if expire := c.String("expire"); expire != "" {
+		if opts.lifetime, err = parseExpiry(expire); err != nil {
+			return nil, err
+		}
+		opts.dedupe = dedupeOff
+	}
+	return opts, nil
+}
+
+// upload uploads the files to the profile's backend with the settings of the
+// command line. See uploadWith. It returns the created gist or an error.
+func upload(c *cli.Context, description string, public bool, files []*file) (*remoteGist, error) {
+	b, err := loadBackend(c)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := newUploadOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	return uploadWith(b, opts, description, public, files)
+}
+
+// uploadWith uploads the files to the backend, and records the gist in the
+// history. The hooks run before and after. When deduplicating, an existing gist
+// with the same description and files is returned instead (and given to the
+// post-upload hooks).
+// With a lifetime, the gist is recorded for reap to delete. It returns the
+// created gist or an error.
+func uploadWith(b backend, opts *uploadOptions, description string, public bool, files []*file) (*remoteGist, error) {
+	var err error
+	if len(opts.hooks.Pre) > 0 {
+		if description, files, err = preUpload(opts.profile, opts.hooks, description, public, files); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.dedupe != dedupeOff {
+		if existing := findDuplicate(opts.profile, b, description, public, files, opts.dedupe == dedupeRemote); existing != nil {
+			// stdout is kept for the URL
+			fmt.Fprintln(os.Stderr, "An identical gist already exists (use --force-new to upload anyway)")
+			if len(opts.hooks.Post) > 0 {
+				postUpload(opts.profile, opts.hooks, existing, public, files, true)
+			}
+			return existing, nil
+		}
+	}
+
+	var created *remoteGist
+	if opts.lifetime > 0 {
+		created, err = uploadExpiring(b, opts.profile, opts.lifetime, description, public, files)
+	} else {
+		created, err = b.create(description, public, files)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logUpload(opts.profile, opts.client, created, public, files)
+	if len(opts.hooks.Post) > 0 {
+		postUpload(opts.profile, opts.hooks, created, public, files, false)
+	}
+	return created, nil
 }
 
 // execStdin is triggered when stdin input is provided. It will read the data
@@ -156,9 +800,9 @@ func execStdin(c *cli.Context, names []string, files *[]*file) error {
 	}
 
 	// gist file name for stdin (default "gistfile1.txt")
-	fileName := "gistfile1.txt"
-	if len(names) == 1 {
-		fileName = names[0]
+	fileName, err := nameFile(c, overrideAt(names, 0), "gistfile1.txt", 1)
+	if err != nil {
+		return err
 	}
 
 	// buffer lines content from stdout
@@ -188,8 +832,6 @@ func execGlobs(c *cli.Context, names []string, files *[]*file) error {
 		return errExtraNames
 	}
 
-	// length of user provided file names
-	namesLength := len(names)
 	// read each globbed file
 	for i, glob := range c.Args() {
 		contents, err := ioutil.ReadFile(glob)
@@ -198,22 +840,23 @@ func execGlobs(c *cli.Context, names []string, files *[]*file) error {
 			return errFileRead
 		}
 
-		fileName := glob
-		if i+1 <= namesLength {
-			// insert custom file name
-			fileName = names[i]
-		} else {
-			// only keep file name (strip preceding directory)
-			parts := strings.Split(fileName, "/")
-			partsLength := len(parts)
-			if partsLength > 1 {
-				fileName = parts[partsLength-1]
-			}
+		// only keep file name (strip preceding directory)
+		original := glob
+		parts := strings.Split(original, "/")
+		partsLength := len(parts)
+		if partsLength > 1 {
+			original = parts[partsLength-1]
+		}
+		// insert custom file name, or the profile's template
+		fileName, err := nameFile(c, overrideAt(names, i), original, i+1)
+		if err != nil {
+			return err
 		}
 		// create new file entity
 		file := &file{
 			Name:    fileName,
 			Content: string(contents),
+			Source:  glob,
 		}
 		*files = append(*files, file)
 
@@ -232,9 +875,9 @@ func execClipboard(c *cli.Context, names []string, files *[]*file) error {
 	}
 
 	// gist file name for stdin (default "gistfile1.txt")
-	fileName := "gistfile1.txt"
-	if len(names) == 1 {
-		fileName = names[0]
+	fileName, err := nameFile(c, overrideAt(names, 0), "gistfile1.txt", 1)
+	if err != nil {
+		return err
 	}
 
 	pastedText, err := clipboard.ReadAll()
@@ -242,7 +885,7 @@ func execClipboard(c *cli.Context, names []string, files *[]*file) error {
 		return errClipboard
 	}
 	// return error if clipboard is the token
-	if pastedText == c.String("token") {
+	if token, _ := resolveToken(c); token != "" && pastedText == token {
 		return errCopyToken
 	}
 	// update files to contain single file (clipboard)
@@ -257,6 +900,47 @@ func execClipboard(c *cli.Context, names []string, files *[]*file) error {
 	return nil
 }
 
+// execEditor is triggered when editor flag is provided. It will open the
+// editor on a new file, named after the override so the editor picks the right
+// syntax, and update the file array with what was saved. The description can be
+// edited in a header block of the same buffer. It may return an error.
+func execEditor(c *cli.Context, names []string, files *[]*file) error {
+	// return error if files or more than 1 file name override are defined
+	if len(c.Args()) > 0 {
+		return errEditorArgs
+	}
+	if len(names) > 1 {
+		return errExtraNames
+	}
+
+	// gist file name for the editor (default "gistfile1.txt")
+	fileName, err := nameFile(c, overrideAt(names, 0), "gistfile1.txt", 1)
+	if err != nil {
+		return err
+	}
+
+	edited, err := editText(fileName, composeHeader(gistDescription))
+	if err != nil {
+		return err
+	}
+	description, content := parseCompose(edited, gistDescription)
+	if strings.TrimSpace(content) == "" {
+		return errEmptyEdit
+	}
+	gistDescription = description
+
+	// update files to contain single file (editor)
+	*files = []*file{
+		{
+			Name:    fileName,
+			Content: content,
+		},
+	}
+
+	fmt.Printf("Uploading %s as %s\n", "editor", fileName)
+	return nil
+}
+
 // cmdLicense is triggerd on license command
 func cmdLicense(c *cli.Context) error {
 	fmt.Println(`BSD 2-Clause License
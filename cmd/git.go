@@ -0,0 +1,208 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when sharing content from git
+var (
+	errGit      = errors.New("Error: git command failed")
+	errNoRepo   = errors.New("Error: not inside a git repository")
+	errNoChange = errors.New("Error: there are no changes to upload")
+	errNoRev    = errors.New("Error: no revision has been specified")
+)
+
+// repoInfo describes the repository content is shared from
+type repoInfo struct {
+	Name   string // base name of the repository's top level directory
+	Branch string // checked out branch, or HEAD when detached
+	Head   string // full SHA of HEAD
+}
+
+// describe returns a gist description naming the repository, branch and HEAD
+func (r *repoInfo) describe(what string) string {
+	head := r.Head
+	if len(head) > 12 {
+		head = head[:12]
+	}
+	return fmt.Sprintf("%s (%s @ %s): %s", r.Name, r.Branch, head, what)
+}
+
+// git runs a git command and returns its stdout. Failures print git's stderr.
+func git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Stderr.Write(stderr.Bytes())
+		return "", errGit
+	}
+	return stdout.String(), nil
+}
+
+// currentRepo looks up the repository of the working directory. It may return
+// an error.
+func currentRepo() (*repoInfo, error) {
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, errNoRepo
+	}
+	info := &repoInfo{Name: filepath.Base(strings.TrimSpace(top))}
+	if branch, err := git("rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+		info.Branch = strings.TrimSpace(branch)
+	}
+	if head, err := git("rev-parse", "HEAD"); err == nil {
+		info.Head = strings.TrimSpace(head)
+	}
+	return info, nil
+}
+
+// gitPublish uploads files shared from a repository, using the repository
+// description unless one was provided
+func gitPublish(c *cli.Context, repo *repoInfo, what string, files []*file) error {
+	description, err := describe(c, repo.describe(what), "", files)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Printf("Uploading %s\n", f.Name)
+	}
+	return publish(c, description, c.Bool("public"), files)
+}
+
+// cmdGitDiff is triggered on git diff and git staged commands. It uploads the
+// working tree (or staged) diff, optionally limited to the given paths.
+func cmdGitDiff(c *cli.Context, staged bool) error {
+	repo, err := currentRepo()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"diff", "--no-color"}
+	name, what := repo.Name+".diff", "working tree diff"
+	if staged {
+		args = append(args, "--cached")
+		name, what = repo.Name+"-staged.diff", "staged diff"
+	}
+	args = append(append(args, "--"), c.Args()...)
+
+	diff, err := git(args...)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return errNoChange
+	}
+	return gitPublish(c, repo, what, []*file{{Name: name, Content: diff}})
+}
+
+// cmdGitRange is triggered on git range command. It uploads the commits of the
+// range as format-patch output, one .patch file per commit.
+func cmdGitRange(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return errNoRev
+	}
+	revs := c.Args()[0]
+	repo, err := currentRepo()
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "gist-patches")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if _, err := git("format-patch", "--no-color", "--output-directory", dir, revs); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []*file
+	for _, entry := range entries {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return errFileRead
+		}
+		files = append(files, &file{Name: entry.Name(), Content: string(contents)})
+	}
+	if len(files) == 0 {
+		return errNoChange
+	}
+	return gitPublish(c, repo, "patches for "+revs, files)
+}
+
+// cmdGitFiles is triggered on git files command. It uploads the contents of the
+// files changed in a commit, as of that commit.
+func cmdGitFiles(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return errNoRev
+	}
+	rev := c.Args()[0]
+	repo, err := currentRepo()
+	if err != nil {
+		return err
+	}
+
+	// deleted files have no content to share
+	changed, err := git("diff-tree", "-z", "--root", "--no-commit-id", "--name-only", "-r", "--diff-filter=d", rev)
+	if err != nil {
+		return err
+	}
+	paths := strings.Split(strings.TrimSuffix(changed, "\x00"), "\x00")
+	if changed == "" {
+		paths = nil
+	}
+	sort.Strings(paths)
+
+	// gists are flat, so colliding base names keep their directories
+	bases := make(map[string]int)
+	for _, p := range paths {
+		bases[path.Base(p)]++
+	}
+
+	var files []*file
+	for _, p := range paths {
+		contents, err := git("show", rev+":"+p)
+		if err != nil {
+			return err
+		}
+		if strings.IndexByte(contents, 0) >= 0 {
+			fmt.Printf("Skipping binary file %s\n", p)
+			continue
+		}
+		name := path.Base(p)
+		if bases[name] > 1 {
+			name = strings.Replace(p, "/", "-", -1)
+		}
+		files = append(files, &file{Name: name, Content: contents})
+	}
+	if len(files) == 0 {
+		return errNoChange
+	}
+
+	short := rev
+	if sha, err := git("rev-parse", "--short", rev); err == nil {
+		short = strings.TrimSpace(sha)
+	}
+	return gitPublish(c, repo, "files changed in "+short, files)
+}
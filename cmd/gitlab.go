@@ -0,0 +1,329 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errVisibility is returned when a profile maps secret uploads to an unknown
+// GitLab visibility level
+var errVisibility = errors.New("Error: secret_visibility must be private or internal")
+
+// gitlabURL is the GitLab instance used when a profile does not set one
+const gitlabURL = "https://gitlab.com"
+
+// gitlabBackend stores gists as GitLab snippets, either personal snippets or
+// the snippets of a project
+type gitlabBackend struct {
+	api     string // root of the instance's API (e.g. https://gitlab.com/api/v4)
+	token   string // personal, project or OAuth access token with the api scope
+	project string // project ID or path, empty for personal snippets
+	secret  string // visibility of secret uploads, private or internal
+}
+
+// snippet is the representation of a snippet in GitLab's replies
+type snippet struct {
+	ID          int64          `json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Visibility  string         `json:"visibility"`
+	WebURL      string         `json:"web_url"`
+	Author      *snippetAuthor `json:"author"`
+	Files       []*snippetFile `json:"files"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// snippetAuthor is the account owning a snippet
+type snippetAuthor struct {
+	Username string `json:"username"`
+}
+
+// snippetFile is a file of a snippet. Replies only list files, their content
+// is downloaded separately.
+type snippetFile struct {
+	Path   string `json:"path"`
+	RawURL string `json:"raw_url"`
+}
+
+// snippetAction is a file entry of snippet create and update requests
+type snippetAction struct {
+	Action       string `json:"action,omitempty"` // create, update, delete or move
+	FilePath     string `json:"file_path"`
+	PreviousPath string `json:"previous_path,omitempty"`
+	Content      string `json:"content,omitempty"`
+}
+
+// snippetPayload is the structure for snippet POST and PUT requests
+type snippetPayload struct {
+	Title       string           `json:"title,omitempty"`
+	Description *string          `json:"description,omitempty"`
+	Visibility  string           `json:"visibility,omitempty"`
+	Files       []*snippetAction `json:"files,omitempty"`
+}
+
+// newGitLabBackend returns the GitLab backend configured by the profile. It may
+// return an error.
+func newGitLabBackend(p *profile, token string) (*gitlabBackend, error) {
+	b := &gitlabBackend{
+		api:     strings.TrimSuffix(p.URL, "/"),
+		token:   token,
+		project: p.Project,
+		secret:  p.SecretVisibility,
+	}
+	if b.api == "" {
+		b.api = gitlabURL
+	}
+	b.api += "/api/v4"
+	switch b.secret {
+	case "":
+		b.secret = "private"
+	case "private", "internal":
+	default:
+		return nil, errVisibility
+	}
+	return b, nil
+}
+
+// snippetsPath returns the API path of the personal or project snippets
+func (b *gitlabBackend) snippetsPath() string {
+	if b.project != "" {
+		return "/projects/" + url.PathEscape(b.project) + "/snippets"
+	}
+	return "/snippets"
+}
+
+// call sends a request to GitLab's API, mirroring apiCall. It returns the reply
+// body, or an error if the reply does not have the expected status.
+func (b *gitlabBackend) call(method, path string, in interface{}, expect int) ([]byte, error) {
+	if b.token == "" {
+		return nil, errNoToken
+	}
+	var body io.Reader
+	if in != nil {
+		buff := new(bytes.Buffer)
+		if err := json.NewEncoder(buff).Encode(in); err != nil {
+			return nil, err
+		}
+		body = buff
+	}
+	req, err := http.NewRequest(method, b.api+path, body)
+	if err != nil {
+		return nil, err
+	}
+	// bearer tokens, unlike PRIVATE-TOKEN, key the HTTP cache per token
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errNetwork
+	}
+	defer resp.Body.Close()
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errBadResponse
+	}
+
+	if resp.StatusCode != expect {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			return nil, errBadAuth
+		case http.StatusNotFound:
+			return nil, errNotFound
+		case http.StatusTooManyRequests:
+			return nil, errRateLimit
+		}
+		// uncommon error encountered
+		return nil, errors.New(string(reply))
+	}
+	return reply, nil
+}
+
+// snippet fetches a snippet, without its files' content. It may return an
+// error.
+func (b *gitlabBackend) snippet(id string) (*snippet, error) {
+	reply, err := b.call("GET", b.snippetsPath()+"/"+url.PathEscape(id), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var s snippet
+	if err := json.Unmarshal(reply, &s); err != nil {
+		return nil, errBadResponse
+	}
+	return &s, nil
+}
+
+// summary converts a snippet to a gist, without its files' content
+func (b *gitlabBackend) summary(s *snippet) *remoteGist {
+	g := &remoteGist{
+		ID:          strconv.FormatInt(s.ID, 10),
+		URL:         s.WebURL,
+		Description: s.Description,
+		Public:      s.Visibility == "public",
+		Files:       make(map[string]*remoteFile),
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+		// the API exposes no revision IDs, the update time stands in for one
+		History: []*remoteRevision{{Version: s.UpdatedAt.UTC().Format(time.RFC3339Nano), CommittedAt: s.UpdatedAt}},
+	}
+	if s.Author != nil {
+		g.Owner = &remoteOwner{Login: s.Author.Username}
+	}
+	for _, f := range s.Files {
+		g.Files[f.Path] = &remoteFile{Filename: f.Path, RawURL: f.RawURL}
+	}
+	return g
+}
+
+// gist converts a snippet to a gist, downloading the content of its files. It
+// may return an error.
+func (b *gitlabBackend) gist(s *snippet) (*remoteGist, error) {
+	g := b.summary(s)
+	id := g.ID
+	for _, f := range s.Files {
+		path := b.snippetsPath() + "/" + id + "/files/" + url.PathEscape(snippetRef(f.RawURL)) + "/" + url.PathEscape(f.Path) + "/raw"
+		content, err := b.call("GET", path, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		g.Files[f.Path] = &remoteFile{
+			Filename: f.Path,
+			RawURL:   f.RawURL,
+			Size:     len(content),
+			Content:  string(content),
+		}
+	}
+	return g, nil
+}
+
+// snippetRef extracts the branch of a snippet's repository from a file's raw
+// URL (e.g. https://gitlab.com/-/snippets/1/raw/main/add.rb), defaulting to
+// main
+func snippetRef(rawURL string) string {
+	i := strings.Index(rawURL, "/raw/")
+	if i < 0 {
+		return "main"
+	}
+	ref := rawURL[i+len("/raw/"):]
+	if j := strings.Index(ref, "/"); j > 0 {
+		return ref[:j]
+	}
+	return "main"
+}
+
+func (b *gitlabBackend) create(description string, public bool, files []*file) (*remoteGist, error) {
+	// snippets require a title, so the first file name stands in for a missing
+	// description
+	title := description
+	if title == "" && len(files) > 0 {
+		title = files[0].Name
+	}
+	visibility := b.secret
+	if public {
+		visibility = "public"
+	}
+	payload := &snippetPayload{Title: title, Description: &description, Visibility: visibility}
+	for _, f := range files {
+		payload.Files = append(payload.Files, &snippetAction{FilePath: f.Name, Content: f.Content})
+	}
+
+	reply, err := b.call("POST", b.snippetsPath(), payload, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	var s snippet
+	if err := json.Unmarshal(reply, &s); err != nil {
+		return nil, errBadResponse
+	}
+	return b.gist(&s)
+}
+
+func (b *gitlabBackend) get(id string) (*remoteGist, error) {
+	s, err := b.snippet(id)
+	if err != nil {
+		return nil, err
+	}
+	return b.gist(s)
+}
+
+func (b *gitlabBackend) update(id string, patch *patchPayload) (*remoteGist, error) {
+	// file actions depend on whether the snippet already holds the file
+	s, err := b.snippet(id)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for _, f := range s.Files {
+		existing[f.Path] = true
+	}
+
+	payload := &snippetPayload{Description: patch.Description}
+	if patch.Description != nil && *patch.Description != "" {
+		payload.Title = *patch.Description
+	}
+	for name, f := range patch.Files {
+		switch {
+		case f == nil:
+			payload.Files = append(payload.Files, &snippetAction{Action: "delete", FilePath: name})
+		case !existing[name]:
+			payload.Files = append(payload.Files, &snippetAction{Action: "create", FilePath: name, Content: f.Content})
+		case f.Filename != "" && f.Filename != name:
+			payload.Files = append(payload.Files, &snippetAction{Action: "move", FilePath: f.Filename, PreviousPath: name, Content: f.Content})
+		default:
+			payload.Files = append(payload.Files, &snippetAction{Action: "update", FilePath: name, Content: f.Content})
+		}
+	}
+
+	reply, err := b.call("PUT", b.snippetsPath()+"/"+url.PathEscape(id), payload, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var updated snippet
+	if err := json.Unmarshal(reply, &updated); err != nil {
+		return nil, errBadResponse
+	}
+	return b.gist(&updated)
+}
+
+func (b *gitlabBackend) list(limit int) ([]*remoteGist, error) {
+	var gists []*remoteGist
+	for page := 1; ; page++ {
+		reply, err := b.call("GET", b.snippetsPath()+"?per_page=100&page="+strconv.Itoa(page), nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var snippets []*snippet
+		if err := json.Unmarshal(reply, &snippets); err != nil {
+			return nil, errBadResponse
+		}
+		for _, s := range snippets {
+			gists = append(gists, b.summary(s))
+			if limit > 0 && len(gists) >= limit {
+				return gists, nil
+			}
+		}
+		if len(snippets) < 100 {
+			return gists, nil
+		}
+	}
+}
+
+func (b *gitlabBackend) remove(id string) error {
+	_, err := b.call("DELETE", b.snippetsPath()+"/"+url.PathEscape(id), nil, http.StatusNoContent)
+	return err
+}
@@ -0,0 +1,358 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSnippet is a snippet stored by fakeGitLab
+type fakeSnippet struct {
+	ID          int64
+	Title       string
+	Description string
+	Visibility  string
+	Files       map[string]string
+	UpdatedAt   time.Time
+}
+
+// fakeGitLab serves the snippet endpoints of GitLab's API from memory, for the
+// personal snippets or the snippets of a single project
+type fakeGitLab struct {
+	*httptest.Server
+	prefix string // escaped path of the snippets, e.g. /api/v4/snippets
+
+	mu       sync.Mutex
+	snippets map[int64]*fakeSnippet
+	next     int64
+	payloads []*snippetPayload // bodies of create and update requests
+	status   int               // status of every reply when non-zero
+}
+
+// newFakeGitLab starts a fake serving the snippets of the project, or personal
+// snippets if it is empty
+func newFakeGitLab(project string) *fakeGitLab {
+	f := &fakeGitLab{prefix: "/api/v4/snippets", snippets: make(map[int64]*fakeSnippet)}
+	if project != "" {
+		f.prefix = "/api/v4/projects/" + url.PathEscape(project) + "/snippets"
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+// render encodes a snippet as GitLab does, listing its files without content
+func (f *fakeGitLab) render(s *fakeSnippet) *snippet {
+	id := strconv.FormatInt(s.ID, 10)
+	out := &snippet{
+		ID:          s.ID,
+		Title:       s.Title,
+		Description: s.Description,
+		Visibility:  s.Visibility,
+		WebURL:      f.URL + "/-/snippets/" + id,
+		Author:      &snippetAuthor{Username: "tanuki"},
+		UpdatedAt:   s.UpdatedAt,
+	}
+	names := make([]string, 0, len(s.Files))
+	for name := range s.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.Files = append(out.Files, &snippetFile{Path: name, RawURL: f.URL + "/-/snippets/" + id + "/raw/main/" + name})
+	}
+	return out
+}
+
+func (f *fakeGitLab) serve(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reply := func(status int, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	if f.status != 0 {
+		reply(f.status, map[string]string{"message": http.StatusText(f.status)})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer gl-token" {
+		reply(http.StatusUnauthorized, map[string]string{"message": "401 Unauthorized"})
+		return
+	}
+	path := req.URL.EscapedPath()
+	if !strings.HasPrefix(path, f.prefix) {
+		reply(http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, f.prefix), "/"), "/")
+
+	if parts[0] == "" {
+		switch req.Method {
+		case "GET":
+			perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+			page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+			ids := make([]int64, 0, len(f.snippets))
+			for id := range f.snippets {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+			listed := make([]*snippet, 0)
+			for i := (page - 1) * perPage; i < len(ids) && i < page*perPage; i++ {
+				listed = append(listed, f.render(f.snippets[ids[i]]))
+			}
+			reply(http.StatusOK, listed)
+		case "POST":
+			var in snippetPayload
+			json.NewDecoder(req.Body).Decode(&in)
+			f.payloads = append(f.payloads, &in)
+			f.next++
+			s := &fakeSnippet{ID: f.next, Title: in.Title, Visibility: in.Visibility, Files: make(map[string]string), UpdatedAt: time.Now()}
+			if in.Description != nil {
+				s.Description = *in.Description
+			}
+			for _, action := range in.Files {
+				s.Files[action.FilePath] = action.Content
+			}
+			f.snippets[s.ID] = s
+			reply(http.StatusCreated, f.render(s))
+		}
+		return
+	}
+
+	id, _ := strconv.ParseInt(parts[0], 10, 64)
+	s, ok := f.snippets[id]
+	if !ok {
+		reply(http.StatusNotFound, map[string]string{"message": "404 Snippet Not Found"})
+		return
+	}
+	switch {
+	case len(parts) == 1 && req.Method == "GET":
+		reply(http.StatusOK, f.render(s))
+	case len(parts) == 1 && req.Method == "PUT":
+		var in snippetPayload
+		json.NewDecoder(req.Body).Decode(&in)
+		f.payloads = append(f.payloads, &in)
+		if in.Title != "" {
+			s.Title = in.Title
+		}
+		if in.Description != nil {
+			s.Description = *in.Description
+		}
+		for _, action := range in.Files {
+			switch action.Action {
+			case "delete":
+				delete(s.Files, action.FilePath)
+			case "move":
+				delete(s.Files, action.PreviousPath)
+				s.Files[action.FilePath] = action.Content
+			default:
+				s.Files[action.FilePath] = action.Content
+			}
+		}
+		s.UpdatedAt = time.Now()
+		reply(http.StatusOK, f.render(s))
+	case len(parts) == 1 && req.Method == "DELETE":
+		delete(f.snippets, id)
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 5 && parts[1] == "files" && parts[4] == "raw" && req.Method == "GET":
+		name, _ := url.PathUnescape(parts[3])
+		content, ok := s.Files[name]
+		if !ok || parts[2] != "main" {
+			reply(http.StatusNotFound, map[string]string{"message": "404 File Not Found"})
+			return
+		}
+		w.Write([]byte(content))
+	default:
+		reply(http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// fail makes the fake reply with the status to every request
+func (f *fakeGitLab) fail(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+// sent returns the body of the i-th create or update request
+func (f *fakeGitLab) sent(i int) *snippetPayload {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.payloads[i]
+}
+
+// backend returns a GitLab backend pointed at the fake
+func (f *fakeGitLab) backend(t *testing.T, project string) *gitlabBackend {
+	b, err := newGitLabBackend(&profile{Backend: "gitlab", URL: f.URL + "/", Project: project}, "gl-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGitLabCreateGet(t *testing.T) {
+	f := newFakeGitLab("")
+	defer f.Close()
+	b := f.backend(t, "")
+
+	created, err := b.create("", false, []*file{
+		{Name: "main.go", Content: "package main\n"},
+		{Name: "README.md", Content: "# notes\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a missing description takes the first file name as the title, and secret
+	// uploads are private
+	in := f.sent(0)
+	if in.Title != "main.go" || in.Visibility != "private" || len(in.Files) != 2 {
+		t.Fatalf("create sent %+v", in)
+	}
+	if created.ID != "1" || created.Public || created.URL != f.URL+"/-/snippets/1" {
+		t.Fatalf("created %+v", created)
+	}
+	if created.Files["main.go"] == nil || created.Files["main.go"].Content != "package main\n" {
+		t.Fatalf("created files %+v", created.Files)
+	}
+
+	if _, err := b.create("shared", true, []*file{{Name: "a.txt", Content: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if in := f.sent(1); in.Title != "shared" || in.Visibility != "public" {
+		t.Fatalf("public create sent %+v", in)
+	}
+
+	g, err := b.get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := remoteFiles(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["README.md"] != "# notes\n" || g.Owner.Login != "tanuki" || g.revision() == "" {
+		t.Fatalf("fetched %+v with files %v", g, files)
+	}
+}
+
+func TestGitLabUpdate(t *testing.T) {
+	f := newFakeGitLab("")
+	defer f.Close()
+	b := f.backend(t, "")
+	if _, err := b.create("notes", false, []*file{
+		{Name: "keep.txt", Content: "keep"},
+		{Name: "old.txt", Content: "old"},
+		{Name: "gone.txt", Content: "gone"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	description := "renamed notes"
+	updated, err := b.update("1", &patchPayload{
+		Description: &description,
+		Files: map[string]*filePatch{
+			"keep.txt": {Content: "kept"},
+			"old.txt":  {Content: "new", Filename: "new.txt"},
+			"gone.txt": nil,
+			"add.txt":  {Content: "added"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := make(map[string]string)
+	for _, action := range f.sent(1).Files {
+		actions[action.FilePath] = action.Action
+	}
+	want := map[string]string{"keep.txt": "update", "new.txt": "move", "gone.txt": "delete", "add.txt": "create"}
+	for name, action := range want {
+		if actions[name] != action {
+			t.Errorf("%s was sent as %q, want %q", name, actions[name], action)
+		}
+	}
+	if f.sent(1).Title != description {
+		t.Errorf("title %q, want the new description", f.sent(1).Title)
+	}
+
+	files, err := remoteFiles(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files["keep.txt"] != "kept" || files["new.txt"] != "new" || files["add.txt"] != "added" {
+		t.Fatalf("files after update %v", files)
+	}
+}
+
+func TestGitLabListRemove(t *testing.T) {
+	f := newFakeGitLab("group/project")
+	defer f.Close()
+	b := f.backend(t, "group/project")
+	for i := 0; i < 3; i++ {
+		if _, err := b.create("snippet "+strconv.Itoa(i), true, []*file{{Name: "a.txt", Content: "a"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listed, err := b.list(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 3 || listed[0].Description != "snippet 2" {
+		t.Fatalf("listed %d snippets, first %+v", len(listed), listed[0])
+	}
+	if f := listed[0].Files["a.txt"]; f == nil || f.Content != "" {
+		t.Fatalf("listed file %+v, want it without content", f)
+	}
+	if listed, err := b.list(2); err != nil || len(listed) != 2 {
+		t.Fatalf("limited listing returned %d snippets and %v", len(listed), err)
+	}
+
+	if err := b.remove("2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.get("2"); err != errNotFound {
+		t.Fatalf("get after remove returned %v, want errNotFound", err)
+	}
+	if err := b.remove("2"); err != errNotFound {
+		t.Fatalf("second remove returned %v, want errNotFound", err)
+	}
+}
+
+func TestGitLabErrors(t *testing.T) {
+	f := newFakeGitLab("")
+	defer f.Close()
+	upload := []*file{{Name: "a.txt", Content: "a"}}
+
+	if _, err := newGitLabBackend(&profile{SecretVisibility: "hidden"}, "gl-token"); err != errVisibility {
+		t.Errorf("invalid secret_visibility returned %v, want errVisibility", err)
+	}
+	if _, err := (&gitlabBackend{api: f.URL + "/api/v4"}).create("", false, upload); err != errNoToken {
+		t.Errorf("missing token returned %v, want errNoToken", err)
+	}
+	if _, err := (&gitlabBackend{api: f.URL + "/api/v4", token: "wrong"}).create("", false, upload); err != errBadAuth {
+		t.Errorf("bad token returned %v, want errBadAuth", err)
+	}
+
+	b := f.backend(t, "")
+	f.fail(http.StatusTooManyRequests)
+	if _, err := b.get("1"); err != errRateLimit {
+		t.Errorf("429 returned %v, want errRateLimit", err)
+	}
+	f.fail(http.StatusInternalServerError)
+	if _, err := b.create("", false, upload); err == nil || !strings.Contains(err.Error(), "Internal Server Error") {
+		t.Errorf("500 returned %v, want the reply as the error", err)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when reading or filtering the history
+var (
+	errHistoryRead = errors.New("Error: cannot read the history")
+	errLogAction   = errors.New("Error: unknown action (expected upload, update or delete)")
+	errSince       = errors.New("Error: invalid time (expected a date such as 2019-06-01, or a duration such as 24h or 7d)")
+	errLogVisible  = errors.New("Error: unknown visibility (expected public or secret)")
+)
+
+// the actions recorded in the history
+const (
+	actionUpload = "upload"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+// historyEntry is a line of the history: a gist that was uploaded, updated or
+// deleted. Only the hashes of the files' content are kept.
+type historyEntry struct {
+	Time        time.Time      `json:"time"`
+	Action      string         `json:"action"`
+	ID          string         `json:"id"`
+	URL         string         `json:"url"`
+	Visibility  string         `json:"visibility,omitempty"` // public or secret, unknown for deletions
+	Description string         `json:"description,omitempty"`
+	Profile     string         `json:"profile"`
+	Client      string         `json:"client,omitempty"` // serve client that uploaded, if any
+	Files       []*historyFile `json:"files,omitempty"`
+}
+
+// historyFile is a file of a history entry
+type historyFile struct {
+	Name    string `json:"name"`
+	Source  string `json:"source,omitempty"` // path the content was read from, if any
+	SHA256  string `json:"sha256,omitempty"` // hash of the content, empty when deleted
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// historyPath returns the location of the history file. It may return an
+// error.
+func historyPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// visibility names the visibility of a gist
+func visibility(public bool) string {
+	if public {
+		return "public"
+	}
+	return "secret"
+}
+
+// appendHistory appends an entry to the history, a file of one JSON entry per
+// line that is never rewritten. Failures are printed rather than returned, as
+// the change to the gist has already been made.
+func appendHistory(e *historyEntry) {
+	e.Time = time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err == nil {
+		var path string
+		if path, err = historyPath(); err == nil {
+			if err = os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+				var f *os.File
+				if f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err == nil {
+					// a single write per entry, so concurrent writers do not interleave
+					_, err = f.Write(append(line, '\n'))
+					if closeErr := f.Close(); err == nil {
+						err = closeErr
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to record the %s of %s in the history\n", e.Action, e.URL)
+	}
+}
+
+// logUpload records an uploaded gist in the history
+func logUpload(profile, client string, g *remoteGist, public bool, files []*file) {
+	e := &historyEntry{
+		Action:      actionUpload,
+		ID:          g.ID,
+		URL:         g.URL,
+		Visibility:  visibility(public),
+		Description: g.Description,
+		Profile:     profile,
+		Client:      client,
+	}
+	for _, f := range files {
+		e.Files = append(e.Files, &historyFile{Name: f.Name, Source: f.Source, SHA256: contentHash(f.Content)})
+	}
+	sort.Slice(e.Files, func(i, j int) bool { return e.Files[i].Name < e.Files[j].Name })
+	appendHistory(e)
+}
+
+// logUpdate records the files changed by a patch in the history. Sources maps
+// file names to the paths they were read from, and may be nil.
+func logUpdate(profile string, g *remoteGist, patch *patchPayload, sources map[string]string) {
+	e := &historyEntry{
+		Action:      actionUpdate,
+		ID:          g.ID,
+		URL:         g.URL,
+		Visibility:  visibility(g.Public),
+		Description: g.Description,
+		Profile:     profile,
+	}
+	for _, name := range sortedKeys(patch.Files) {
+		f := patch.Files[name]
+		switch {
+		case f == nil:
+			e.Files = append(e.Files, &historyFile{Name: name, Source: sources[name], Deleted: true})
+		case f.Filename != "" && f.Content == "":
+			// a rename keeps the content, which the patch does not hold
+			e.Files = append(e.Files, &historyFile{Name: name, Deleted: true}, &historyFile{Name: f.Filename})
+		default:
+			renamed := name
+			if f.Filename != "" {
+				renamed = f.Filename
+			}
+			e.Files = append(e.Files, &historyFile{Name: renamed, Source: sources[name], SHA256: contentHash(f.Content)})
+		}
+	}
+	appendHistory(e)
+}
+
+// logDelete records a deleted gist in the history
+func logDelete(profile, id, url string) {
+	appendHistory(&historyEntry{Action: actionDelete, ID: id, URL: url, Profile: profile})
+}
+
+// sortedKeys returns the file names of a patch, sorted
+func sortedKeys(files map[string]*filePatch) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadHistory reads every entry of the history, oldest first. A missing file
+// yields none. It may return an error.
+func loadHistory() ([]*historyEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, errHistoryRead
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errHistoryRead
+	}
+	defer f.Close()
+
+	var entries []*historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e historyEntry
+		// skip a line torn by a crash rather than hiding the rest
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, &e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errHistoryRead
+	}
+	return entries, nil
+}
+
+// parseSince parses a point in time: a date (2019-06-01), a date and time in
+// RFC 3339, or a duration before now (24h or 7d). It may return an error.
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	ago, err := parseExpiry(value)
+	if err != nil {
+		return time.Time{}, errSince
+	}
+	return time.Now().Add(-ago), nil
+}
+
+// historyFilter selects history entries, as set by the log command's flags
+type historyFilter struct {
+	id, action, profile, visibility, file string
+	since, until                          time.Time
+}
+
+// newHistoryFilter reads the log command's flags. It may return an error.
+func newHistoryFilter(c *cli.Context) (*historyFilter, error) {
+	filter := &historyFilter{
+		action:     strings.ToLower(c.String("action")),
+		profile:    c.String("profile"),
+		visibility: strings.ToLower(c.String("visibility")),
+		file:       c.String("file"),
+	}
+	if id := c.String("id"); id != "" {
+		filter.id = parseGistID(id)
+	}
+	switch filter.action {
+	case "", actionUpload, actionUpdate, actionDelete:
+	default:
+		return nil, errLogAction
+	}
+	switch filter.visibility {
+	case "", "public", "secret":
+	default:
+		return nil, errLogVisible
+	}
+	var err error
+	if since := c.String("since"); since != "" {
+		if filter.since, err = parseSince(since); err != nil {
+			return nil, err
+		}
+	}
+	if until := c.String("until"); until != "" {
+		if filter.until, err = parseSince(until); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// match reports whether an entry is selected by the filter
+func (filter *historyFilter) match(e *historyEntry) bool {
+	switch {
+	case filter.id != "" && e.ID != filter.id,
+		filter.action != "" && e.Action != filter.action,
+		filter.profile != "" && e.Profile != filter.profile,
+		filter.visibility != "" && e.Visibility != filter.visibility,
+		!filter.since.IsZero() && e.Time.Before(filter.since),
+		!filter.until.IsZero() && !e.Time.Before(filter.until):
+		return false
+	}
+	if filter.file == "" {
+		return true
+	}
+	for _, f := range e.Files {
+		if strings.Contains(f.Name, filter.file) || strings.Contains(f.Source, filter.file) {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdLog is triggered on log command. It prints the history of uploads,
+// updates and deletions made from this machine, most recent first, as text or
+// JSON.
+func cmdLog(c *cli.Context) error {
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+	filter, err := newHistoryFilter(c)
+	if err != nil {
+		return err
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	limit := c.Int("limit")
+	selected := make([]*historyEntry, 0)
+	for i := len(entries) - 1; i >= 0 && (limit <= 0 || len(selected) < limit); i-- {
+		if filter.match(entries[i]) {
+			selected = append(selected, entries[i])
+		}
+	}
+	if asJSON {
+		return printJSON(selected)
+	}
+	for _, e := range selected {
+		printHistoryEntry(e)
+	}
+	return nil
+}
+
+// printHistoryEntry prints an entry as text: its time, action, URL and
+// description, followed by an indented line describing its files
+func printHistoryEntry(e *historyEntry) {
+	line := fmt.Sprintf("%s  %-6s  %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, e.URL)
+	if e.Description != "" {
+		line += "  " + e.Description
+	}
+	fmt.Println(line)
+
+	var files []string
+	for _, f := range e.Files {
+		switch {
+		case f.Deleted:
+			files = append(files, f.Name+" (deleted)")
+		case f.Source != "" && f.Source != f.Name:
+			files = append(files, f.Name+" from "+f.Source)
+		default:
+			files = append(files, f.Name)
+		}
+	}
+	details := []string{"profile " + e.Profile}
+	if e.Visibility != "" {
+		details = append([]string{e.Visibility}, details...)
+	}
+	if e.Client != "" {
+		details = append(details, "client "+e.Client)
+	}
+	if len(files) > 0 {
+		fmt.Printf("    %s (%s)\n", strings.Join(files, ", "), strings.Join(details, ", "))
+	} else {
+		fmt.Printf("    (%s)\n", strings.Join(details, ", "))
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// errors when running upload hooks
+var (
+	errHookTimeout = errors.New("Error: invalid hook timeout in the profile")
+	errHookVeto    = errors.New("Error: the upload was rejected by a pre-upload hook")
+	errHookFailed  = errors.New("Error: a pre-upload hook failed, nothing was uploaded")
+)
+
+// defaultHookTimeout is how long a hook may run when the profile sets no
+// timeout
+const defaultHookTimeout = 30 * time.Second
+
+// the hook events, given to hooks in GIST_HOOK
+const (
+	hookPreUpload  = "pre-upload"
+	hookPostUpload = "post-upload"
+)
+
+// hooksConfig lists the executables run around uploads. Each receives JSON on
+// stdin. A pre-upload hook may print JSON to replace the description and
+// files, and rejects the upload by exiting with a non-zero status.
+type hooksConfig struct {
+	Pre     []string `json:"pre,omitempty"`     // run before uploading, in order
+	Post    []string `json:"post,omitempty"`    // run after uploading, in order
+	Timeout string   `json:"timeout,omitempty"` // for each hook (default 30s)
+}
+
+// hookFile is a file as given to (and returned by) hooks
+type hookFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Source  string `json:"source,omitempty"`
+}
+
+// preUploadInput is the JSON given to pre-upload hooks
+type preUploadInput struct {
+	Event       string      `json:"event"`
+	Profile     string      `json:"profile"`
+	Description string      `json:"description"`
+	Public      bool        `json:"public"`
+	Files       []*hookFile `json:"files"`
+}
+
+// preUploadOutput is the JSON a pre-upload hook may print, replacing the
+// description and files it holds
+type preUploadOutput struct {
+	Description *string     `json:"description"`
+	Files       []*hookFile `json:"files"`
+}
+
+// postUploadInput is the JSON given to post-upload hooks
+type postUploadInput struct {
+	Event       string   `json:"event"`
+	Profile     string   `json:"profile"`
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Public      bool     `json:"public"`
+	Files       []string `json:"files"`
+	Reused      bool     `json:"reused"` // an identical gist existed, nothing was uploaded
+}
+
+// hookTimeout returns how long each hook may run. It may return an error.
+func (h *hooksConfig) hookTimeout() (time.Duration, error) {
+	if h.Timeout == "" {
+		return defaultHookTimeout, nil
+	}
+	timeout, err := time.ParseDuration(h.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, errHookTimeout
+	}
+	return timeout, nil
+}
+
+// hookFailure describes why a hook failed
+type hookFailure struct {
+	reason   string
+	rejected bool // the hook ran and exited with a non-zero status
+}
+
+// runHook runs a hook executable with the input as JSON on stdin, and returns
+// what it printed on stdout. The hook's stderr is passed through. It returns
+// the failure of the hook, if any.
+func runHook(path, event string, input interface{}, timeout time.Duration) ([]byte, *hookFailure) {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, &hookFailure{reason: err.Error()}
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "GIST_HOOK="+event)
+	if err := cmd.Start(); err != nil {
+		return nil, &hookFailure{reason: "cannot be started (" + err.Error() + ")"}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if exit, ok := err.(*exec.ExitError); ok {
+			return nil, &hookFailure{reason: "exited with " + exit.ProcessState.String(), rejected: true}
+		}
+		if err != nil {
+			return nil, &hookFailure{reason: err.Error()}
+		}
+		return stdout.Bytes(), nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return nil, &hookFailure{reason: fmt.Sprintf("timed out after %s", timeout)}
+	}
+}
+
+// preUpload runs the profile's pre-upload hooks in order, each seeing the
+// changes of the previous ones. It returns the description and files to upload,
+// or an error if a hook failed or rejected the upload.
+func preUpload(profile string, hooks *hooksConfig, description string, public bool, files []*file) (string, []*file, error) {
+	timeout, err := hooks.hookTimeout()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, path := range hooks.Pre {
+		input := &preUploadInput{
+			Event:       hookPreUpload,
+			Profile:     profile,
+			Description: description,
+			Public:      public,
+		}
+		for _, f := range files {
+			input.Files = append(input.Files, &hookFile{Name: f.Name, Content: f.Content, Source: f.Source})
+		}
+
+		out, failure := runHook(path, hookPreUpload, input, timeout)
+		if failure != nil {
+			fmt.Fprintf(os.Stderr, "Pre-upload hook %s %s\n", path, failure.reason)
+			if failure.rejected {
+				return "", nil, errHookVeto
+			}
+			return "", nil, errHookFailed
+		}
+		if len(bytes.TrimSpace(out)) == 0 {
+			// nothing printed leaves the upload as it is
+			continue
+		}
+
+		var output preUploadOutput
+		if err := json.Unmarshal(out, &output); err != nil {
+			fmt.Fprintf(os.Stderr, "Pre-upload hook %s printed invalid JSON\n", path)
+			return "", nil, errHookFailed
+		}
+		if output.Description != nil {
+			description = *output.Description
+		}
+		if output.Files != nil {
+			files = nil
+			for _, f := range output.Files {
+				if f.Name == "" || strings.TrimSpace(f.Content) == "" {
+					fmt.Fprintf(os.Stderr, "Pre-upload hook %s returned a file without a name or content\n", path)
+					return "", nil, errHookFailed
+				}
+				files = append(files, &file{Name: f.Name, Content: f.Content, Source: f.Source})
+			}
+			if len(files) == 0 {
+				fmt.Fprintf(os.Stderr, "Pre-upload hook %s returned no files\n", path)
+				return "", nil, errHookFailed
+			}
+		}
+	}
+	return description, files, nil
+}
+
+// postUpload runs the profile's post-upload hooks in order with the created
+// gist, or the existing one reused in its place. Failures are printed rather
+// than returned, as the gist exists.
+func postUpload(profile string, hooks *hooksConfig, created *remoteGist, public bool, files []*file, reused bool) {
+	timeout, err := hooks.hookTimeout()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	input := &postUploadInput{
+		Event:       hookPostUpload,
+		Profile:     profile,
+		ID:          created.ID,
+		URL:         created.URL,
+		Description: created.Description,
+		Public:      public,
+		Reused:      reused,
+	}
+	for _, f := range files {
+		input.Files = append(input.Files, f.Name)
+	}
+	for _, path := range hooks.Post {
+		out, failure := runHook(path, hookPostUpload, input, timeout)
+		// stdout is kept for the URL
+		os.Stderr.Write(out)
+		if failure != nil {
+			fmt.Fprintf(os.Stderr, "Post-upload hook %s %s\n", path, failure.reason)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when building or searching the local index
+var (
+	errIndexRead  = errors.New("Error: cannot read the local gist index")
+	errIndexWrite = errors.New("Error: cannot write the local gist index")
+	errNoIndex    = errors.New("Error: the local index is empty (run \"gist index\")")
+	errNoQuery    = errors.New("Error: no search terms have been specified")
+	errSearchIn   = errors.New("Error: search fields must be description, files or content")
+)
+
+// gistIndex is the local index of gists, stored as a single file in the cache
+// directory. Each profile has its own account, as profiles may belong to
+// different users.
+type gistIndex struct {
+	Accounts map[string]*indexAccount `json:"accounts"`
+}
+
+// indexAccount holds the indexed gists of an account, and what is needed to
+// fetch incremental updates
+type indexAccount struct {
+	Since     time.Time               `json:"since"`      // most recent update seen, used as since
+	ListPath  string                  `json:"list_path"`  // first list page of the last fetch
+	ListETag  string                  `json:"list_etag"`  // ETag of that page
+	FetchedAt time.Time               `json:"fetched_at"` // time of the last fetch
+	Gists     map[string]*indexedGist `json:"gists"`
+}
+
+// indexedGist is a gist with the content of its files
+type indexedGist struct {
+	ID          string            `json:"id"`
+	URL         string            `json:"url"`
+	Description string            `json:"description"`
+	Public      bool              `json:"public"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	ETag        string            `json:"etag"`
+	Files       map[string]string `json:"files"` // file name to content
+}
+
+// indexPath returns the location of the index file. It may return an error.
+func indexPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "index.json"), nil
+}
+
+// loadIndex reads the index file. A missing file yields an empty index. It may
+// return an error.
+func loadIndex() (*gistIndex, error) {
+	index := &gistIndex{Accounts: make(map[string]*indexAccount)}
+	path, err := indexPath()
+	if err != nil {
+		return nil, errIndexRead
+	}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, errIndexRead
+	}
+	if err := json.Unmarshal(contents, index); err != nil {
+		return nil, errIndexRead
+	}
+	if index.Accounts == nil {
+		index.Accounts = make(map[string]*indexAccount)
+	}
+	return index, nil
+}
+
+// save writes the index file, readable by the current user only, as it holds
+// the content of secret gists. It may return an error.
+func (index *gistIndex) save() error {
+	path, err := indexPath()
+	if err != nil {
+		return errIndexWrite
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errIndexWrite
+	}
+	contents, err := json.Marshal(index)
+	if err != nil {
+		return errIndexWrite
+	}
+	// write then rename, so an interrupted fetch keeps the previous index
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0600); err != nil {
+		return errIndexWrite
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errIndexWrite
+	}
+	return nil
+}
+
+// account returns the indexed account of a profile, creating it if needed
+func (index *gistIndex) account(name string) *indexAccount {
+	account, ok := index.Accounts[name]
+	if !ok {
+		account = &indexAccount{}
+		index.Accounts[name] = account
+	}
+	if account.Gists == nil {
+		account.Gists = make(map[string]*indexedGist)
+	}
+	return account
+}
+
+// cmdIndex is triggered on index command. It fetches the gists updated since
+// the last fetch (or all of them with --full) into the local index.
+func cmdIndex(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+	account := index.account(profileName(c))
+	full := c.Bool("full") || account.FetchedAt.IsZero()
+
+	path := "/gists?per_page=100"
+	if !full {
+		path += "&since=" + account.Since.UTC().Format(time.RFC3339)
+	}
+
+	// list the gists, stopping early if the first page is unchanged (a full
+	// listing must be read in whole to find deleted gists)
+	var listed []*remoteGist
+	etag := ""
+	if path == account.ListPath && !full {
+		etag = account.ListETag
+	}
+	listPath, listETag := account.ListPath, account.ListETag
+	for page := path; page != ""; {
+		var gists []*remoteGist
+		resp, unchanged, err := conditionalGet(token, page, etag, &gists)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			break
+		}
+		if page == path {
+			account.ListPath, account.ListETag = path, resp.Header.Get("ETag")
+		}
+		listed = append(listed, gists...)
+		page, etag = nextPage(resp), ""
+	}
+
+	// a failed fetch keeps the gists indexed so far, but not the listing's
+	// position, so the next run lists them again and fetches the rest
+	since := account.Since
+	failed := func(err error) error {
+		account.ListPath, account.ListETag = listPath, listETag
+		if saveErr := index.save(); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+
+	fetched, removed := 0, 0
+	seen := make(map[string]bool)
+	for _, listedGist := range listed {
+		seen[listedGist.ID] = true
+		indexed, ok := account.Gists[listedGist.ID]
+		if ok && indexed.UpdatedAt.Equal(listedGist.UpdatedAt) {
+			continue
+		}
+		if !ok {
+			indexed = &indexedGist{ID: listedGist.ID}
+		}
+
+		var g remoteGist
+		resp, unchanged, err := conditionalGet(token, "/gists/"+listedGist.ID, indexed.ETag, &g)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return failed(err)
+		}
+		indexed.UpdatedAt = listedGist.UpdatedAt
+		if !unchanged {
+			files, err := remoteFiles(&g)
+			if err != nil {
+				return failed(err)
+			}
+			indexed.URL = g.URL
+			indexed.Description = g.Description
+			indexed.Public = g.Public
+			indexed.ETag = resp.Header.Get("ETag")
+			indexed.Files = files
+			fetched++
+		}
+		account.Gists[listedGist.ID] = indexed
+		if listedGist.UpdatedAt.After(since) {
+			since = listedGist.UpdatedAt
+		}
+	}
+
+	// only a full listing reveals deleted gists
+	if full {
+		for id := range account.Gists {
+			if !seen[id] {
+				delete(account.Gists, id)
+				removed++
+			}
+		}
+	}
+
+	account.Since = since
+	account.FetchedAt = time.Now()
+	if err := index.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d gists (%d fetched, %d removed)\n", len(account.Gists), fetched, removed)
+	return nil
+}
+
+// searchMatch is a line of a file matching the search
+type searchMatch struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// searchResult is a gist matching the search, with its score and matches
+type searchResult struct {
+	*summary
+	Score   int            `json:"score"`
+	Matches []*searchMatch `json:"matches,omitempty"`
+}
+
+// scoreGist ranks how well a gist matches every term, searching the selected
+// fields. Descriptions weigh the most, then file names, then content. It
+// returns zero if any term is missing.
+func scoreGist(g *indexedGist, terms []string, fields map[string]bool) (int, []*searchMatch) {
+	description := strings.ToLower(g.Description)
+	score := 0
+	var matches []*searchMatch
+	for _, term := range terms {
+		termScore := 0
+		if fields["description"] && strings.Contains(description, term) {
+			termScore += 10
+		}
+		for name, content := range g.Files {
+			if fields["files"] && strings.Contains(strings.ToLower(name), term) {
+				termScore += 5
+			}
+			if !fields["content"] {
+				continue
+			}
+			count := strings.Count(strings.ToLower(content), term)
+			if count == 0 {
+				continue
+			}
+			// repeated occurrences count, with diminishing returns
+			if count > 10 {
+				count = 10
+			}
+			termScore += count
+			if match := firstMatch(name, content, term); match != nil {
+				matches = append(matches, match)
+			}
+		}
+		if termScore == 0 {
+			return 0, nil
+		}
+		score += termScore
+	}
+	return score, matches
+}
+
+// firstMatch returns the first line of content containing the term
+func firstMatch(name, content, term string) *searchMatch {
+	for i, line := range strings.Split(content, "\n") {
+		if strings.Contains(strings.ToLower(line), term) {
+			text := []rune(strings.TrimSpace(line))
+			if len(text) > 100 {
+				text = append(text[:100], []rune("...")...)
+			}
+			return &searchMatch{File: name, Line: i + 1, Text: string(text)}
+		}
+	}
+	return nil
+}
+
+// cmdSearch is triggered on search command. It searches the local index
+// offline, printing ranked results.
+func cmdSearch(c *cli.Context) error {
+	var terms []string
+	for _, arg := range c.Args() {
+		for _, term := range strings.Fields(strings.ToLower(arg)) {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return errNoQuery
+	}
+	fields := make(map[string]bool)
+	for _, field := range strings.Split(c.String("in"), ",") {
+		switch field = strings.TrimSpace(field); field {
+		case "description", "files", "content":
+			fields[field] = true
+		default:
+			return errSearchIn
+		}
+	}
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+
+	index, err := loadIndex()
+	if err != nil {
+		return err
+	}
+	account, ok := index.Accounts[profileName(c)]
+	if !ok || len(account.Gists) == 0 {
+		return errNoIndex
+	}
+
+	var results []*searchResult
+	for _, g := range account.Gists {
+		score, matches := scoreGist(g, terms, fields)
+		if score == 0 {
+			continue
+		}
+		names := make([]string, 0, len(g.Files))
+		for name := range g.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		results = append(results, &searchResult{
+			summary: &summary{
+				ID:          g.ID,
+				URL:         g.URL,
+				Description: g.Description,
+				Public:      g.Public,
+				Files:       names,
+				UpdatedAt:   g.UpdatedAt,
+			},
+			Score:   score,
+			Matches: matches,
+		})
+	}
+
+	// best matches first, most recently updated breaking ties
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+	if limit := c.Int("limit"); limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	if asJSON {
+		if results == nil {
+			results = []*searchResult{}
+		}
+		return printJSON(results)
+	}
+	if len(results) == 0 {
+		fmt.Println("No gists found")
+		return nil
+	}
+	for _, result := range results {
+		printSummary(result.summary)
+		for _, match := range result.Matches {
+			fmt.Printf("    %s:%d: %s\n", match.File, match.Line, match.Text)
+		}
+	}
+	return nil
+}
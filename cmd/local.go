@@ -0,0 +1,323 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// errors when storing gists in a local directory
+var (
+	errNoDir      = errors.New("Error: the local backend needs a dir in the profile")
+	errLocalWrite = errors.New("Error: cannot write the gist to the local directory")
+	errLocalName  = errors.New("Error: file names cannot contain path separators")
+)
+
+// localManifestName is the manifest file of a gist stored by the local backend
+const localManifestName = "gist.json"
+
+// localBackend stores gists in a directory, one subdirectory per gist. Each
+// holds the manifest, the current files under files/, and the content of every
+// revision under objects/, addressed by hash. Secret gists are readable by the
+// current user only.
+type localBackend struct {
+	dir string
+}
+
+// localManifest describes a gist stored by the local backend
+type localManifest struct {
+	ID          string           `json:"id"`
+	Description string           `json:"description"`
+	Public      bool             `json:"public"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	History     []*localRevision `json:"history"` // most recent first
+}
+
+// localRevision is a revision of a gist stored by the local backend
+type localRevision struct {
+	Version     string            `json:"version"`
+	CommittedAt time.Time         `json:"committed_at"`
+	Files       map[string]string `json:"files"` // file name to content hash
+}
+
+// newLocalBackend returns the local backend configured by the profile. It may
+// return an error.
+func newLocalBackend(p *profile) (*localBackend, error) {
+	if p.Dir == "" {
+		return nil, errNoDir
+	}
+	return &localBackend{dir: p.Dir}, nil
+}
+
+// randomHex returns n random bytes, hex encoded. It may return an error.
+func randomHex(n int) (string, error) {
+	buff := make([]byte, n)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buff), nil
+}
+
+// modes returns the directory and file modes of a gist, by visibility
+func (m *localManifest) modes() (os.FileMode, os.FileMode) {
+	if m.Public {
+		return 0755, 0644
+	}
+	return 0700, 0600
+}
+
+// load reads the manifest of a gist. It may return an error.
+func (b *localBackend) load(id string) (*localManifest, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, errNotFound
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(b.dir, id, localManifestName))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m localManifest
+	if err := json.Unmarshal(contents, &m); err != nil || len(m.History) == 0 {
+		return nil, errBadResponse
+	}
+	return &m, nil
+}
+
+// commit stores the files as a new revision of the gist, and rewrites its
+// current files and manifest. It may return an error.
+func (b *localBackend) commit(m *localManifest, files map[string]string) error {
+	gistDir := filepath.Join(b.dir, m.ID)
+	dirMode, fileMode := m.modes()
+	// the store itself is shared by public and secret gists
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return errLocalWrite
+	}
+	for _, sub := range []string{"objects", "files"} {
+		if err := os.MkdirAll(filepath.Join(gistDir, sub), dirMode); err != nil {
+			return errLocalWrite
+		}
+	}
+
+	version, err := randomHex(20)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	revision := &localRevision{Version: version, CommittedAt: now, Files: make(map[string]string)}
+	for name, content := range files {
+		if filepath.Base(name) != name {
+			return errLocalName
+		}
+		hash := contentHash(content)
+		if err := ioutil.WriteFile(filepath.Join(gistDir, "objects", hash), []byte(content), fileMode); err != nil {
+			return errLocalWrite
+		}
+		revision.Files[name] = hash
+	}
+
+	// the current files mirror the latest revision
+	current, err := ioutil.ReadDir(filepath.Join(gistDir, "files"))
+	if err != nil {
+		return errLocalWrite
+	}
+	for _, entry := range current {
+		if _, ok := files[entry.Name()]; !ok {
+			os.Remove(filepath.Join(gistDir, "files", entry.Name()))
+		}
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(gistDir, "files", name), []byte(content), fileMode); err != nil {
+			return errLocalWrite
+		}
+	}
+
+	m.UpdatedAt = now
+	m.History = append([]*localRevision{revision}, m.History...)
+	contents, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errLocalWrite
+	}
+	if err := ioutil.WriteFile(filepath.Join(gistDir, localManifestName), contents, fileMode); err != nil {
+		return errLocalWrite
+	}
+	return nil
+}
+
+// gist converts a stored gist at a revision to a gist. It may return an error.
+func (b *localBackend) gist(m *localManifest, revision *localRevision) (*remoteGist, error) {
+	gistDir := filepath.Join(b.dir, m.ID)
+	abs, err := filepath.Abs(gistDir)
+	if err != nil {
+		return nil, err
+	}
+	g := &remoteGist{
+		ID:          m.ID,
+		URL:         (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(),
+		Description: m.Description,
+		Public:      m.Public,
+		Files:       make(map[string]*remoteFile),
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+	for _, r := range m.History {
+		g.History = append(g.History, &remoteRevision{Version: r.Version, CommittedAt: r.CommittedAt})
+	}
+	for name, hash := range revision.Files {
+		path := filepath.Join(gistDir, "objects", hash)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errBadResponse
+		}
+		g.Files[name] = &remoteFile{
+			Filename: name,
+			RawURL:   (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(abs, "objects", hash))}).String(),
+			Size:     len(content),
+			Content:  string(content),
+		}
+	}
+	return g, nil
+}
+
+func (b *localBackend) create(description string, public bool, files []*file) (*remoteGist, error) {
+	id, err := randomHex(10)
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[string]string)
+	for _, f := range files {
+		contents[f.Name] = f.Content
+	}
+	m := &localManifest{ID: id, Description: description, Public: public, CreatedAt: time.Now().UTC()}
+	if err := b.commit(m, contents); err != nil {
+		os.RemoveAll(filepath.Join(b.dir, id))
+		return nil, err
+	}
+	return b.gist(m, m.History[0])
+}
+
+func (b *localBackend) get(id string) (*remoteGist, error) {
+	m, err := b.load(id)
+	if err != nil {
+		return nil, err
+	}
+	return b.gist(m, m.History[0])
+}
+
+// revision fetches a gist as of a past revision. It may return an error.
+func (b *localBackend) revision(id, version string) (*remoteGist, error) {
+	m, err := b.load(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range m.History {
+		if r.Version == version {
+			return b.gist(m, r)
+		}
+	}
+	return nil, errNotFound
+}
+
+func (b *localBackend) update(id string, patch *patchPayload) (*remoteGist, error) {
+	m, err := b.load(id)
+	if err != nil {
+		return nil, err
+	}
+	current, err := b.gist(m, m.History[0])
+	if err != nil {
+		return nil, err
+	}
+	files, err := remoteFiles(current)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply the patch the way GitHub does: nil deletes, a file name renames
+	names := make([]string, 0, len(patch.Files))
+	for name := range patch.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := patch.Files[name]
+		if f == nil {
+			delete(files, name)
+			continue
+		}
+		content, ok := files[name]
+		if f.Content != "" {
+			content, ok = f.Content, true
+		}
+		if !ok {
+			continue
+		}
+		delete(files, name)
+		if f.Filename != "" {
+			name = f.Filename
+		}
+		files[name] = content
+	}
+	if patch.Description != nil {
+		m.Description = *patch.Description
+	}
+
+	if err := b.commit(m, files); err != nil {
+		return nil, err
+	}
+	return b.gist(m, m.History[0])
+}
+
+func (b *localBackend) list(limit int) ([]*remoteGist, error) {
+	entries, err := ioutil.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifests []*localManifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// directories without a readable manifest are not gists
+		if m, err := b.load(entry.Name()); err == nil {
+			manifests = append(manifests, m)
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.After(manifests[j].CreatedAt)
+	})
+	if limit > 0 && len(manifests) > limit {
+		manifests = manifests[:limit]
+	}
+	gists := make([]*remoteGist, 0, len(manifests))
+	for _, m := range manifests {
+		g, err := b.gist(m, m.History[0])
+		if err != nil {
+			return nil, err
+		}
+		gists = append(gists, g)
+	}
+	return gists, nil
+}
+
+func (b *localBackend) remove(id string) error {
+	if _, err := b.load(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(b.dir, id))
+}
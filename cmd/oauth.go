@@ -0,0 +1,222 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors during the OAuth device authorization flow
+var (
+	errNoClientID    = errors.New("Error: no OAuth client ID has been specified")
+	errDeviceExpired = errors.New("Error: the device code expired before it was authorized")
+	errDeviceDenied  = errors.New("Error: the authorization request was denied")
+)
+
+// oauthURL is the root of GitHub's OAuth endpoints. It can be overridden with
+// the GIST_OAUTH_URL environment variable (e.g. for GitHub Enterprise).
+var oauthURL = "https://github.com"
+
+func init() {
+	if url := os.Getenv("GIST_OAUTH_URL"); url != "" {
+		oauthURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// pollUnit is the unit of the intervals and lifetimes in GitHub's device flow
+// replies, which are given in seconds
+var pollUnit = time.Second
+
+// deviceCode is used for parsing GitHub's device code reply
+type deviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// deviceToken is used for parsing GitHub's access token reply, which either
+// holds a token or the reason none has been issued yet
+type deviceToken struct {
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// postForm sends a form to an OAuth endpoint and decodes the JSON reply into
+// v. It may return an error.
+func postForm(path string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest("POST", oauthURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errNetwork
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errBadResponse
+	}
+	if resp.StatusCode != 200 {
+		return errors.New(string(body))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return errBadResponse
+	}
+	return nil
+}
+
+// requestDeviceCode starts the device flow for the OAuth app, requesting the
+// gist scope. It may return an error.
+func requestDeviceCode(clientID string) (*deviceCode, error) {
+	form := url.Values{
+		"client_id": {clientID},
+		"scope":     {"gist"},
+	}
+	var code deviceCode
+	if err := postForm("/login/device/code", form, &code); err != nil {
+		return nil, err
+	}
+	if code.DeviceCode == "" {
+		return nil, errBadResponse
+	}
+	return &code, nil
+}
+
+// pollDeviceToken polls GitHub until the user authorizes the device code, the
+// code expires, or the request is denied. It returns the issued access token or
+// an error.
+func pollDeviceToken(clientID string, code *deviceCode) (string, error) {
+	form := url.Values{
+		"client_id":   {clientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+
+	interval := time.Duration(code.Interval) * pollUnit
+	if interval <= 0 {
+		interval = 5 * pollUnit
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * pollUnit)
+
+	for {
+		time.Sleep(interval)
+		if code.ExpiresIn > 0 && time.Now().After(deadline) {
+			return "", errDeviceExpired
+		}
+
+		var token deviceToken
+		if err := postForm("/login/oauth/access_token", form, &token); err != nil {
+			return "", err
+		}
+		switch token.Error {
+		case "":
+			if token.AccessToken == "" {
+				return "", errBadResponse
+			}
+			return token.AccessToken, nil
+		case "authorization_pending":
+			// user has not entered the code yet
+		case "slow_down":
+			// GitHub asks for 5 extra seconds between polls
+			interval += 5 * pollUnit
+		case "expired_token":
+			return "", errDeviceExpired
+		case "access_denied":
+			return "", errDeviceDenied
+		default:
+			return "", errors.New("Error: " + token.Error + ": " + token.Description)
+		}
+	}
+}
+
+// cmdAuthLogin is triggered on auth login command. It performs the OAuth device
+// flow and stores the resulting token in the selected profile.
+func cmdAuthLogin(c *cli.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := profileName(c)
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		p = &profile{}
+		cfg.Profiles[name] = p
+	}
+
+	clientID := c.String("client-id")
+	if clientID == "" {
+		clientID = p.ClientID
+	}
+	if clientID == "" {
+		return errNoClientID
+	}
+
+	code, err := requestDeviceCode(clientID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("First copy your one-time code: %s\n", code.UserCode)
+	fmt.Printf("Then open %s in your browser to authorize gist\n", code.VerificationURI)
+	fmt.Println("Waiting for authorization...")
+
+	token, err := pollDeviceToken(clientID, code)
+	if err != nil {
+		return err
+	}
+
+	p.Token = token
+	p.ClientID = clientID
+	if err := cfg.save(); err != nil {
+		return err
+	}
+
+	path, _ := configPath()
+	if status, err := checkAuth(token); err == nil {
+		fmt.Printf("Logged in as %s, token stored in %s (profile %s)\n", status.Login, path, name)
+	} else {
+		fmt.Printf("Logged in, token stored in %s (profile %s)\n", path, name)
+	}
+	return nil
+}
+
+// cmdAuthLogout is triggered on auth logout command. It removes the token
+// stored in the selected profile.
+func cmdAuthLogout(c *cli.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := profileName(c)
+	p, ok := cfg.Profiles[name]
+	if !ok || p.Token == "" {
+		fmt.Printf("No token stored for profile %s\n", name)
+		return nil
+	}
+	p.Token = ""
+	if err := cfg.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed stored token for profile %s\n", name)
+	return nil
+}
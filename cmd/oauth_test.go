@@ -0,0 +1,162 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOAuth serves GitHub's device flow endpoints, replying to token polls
+// with the scripted replies in order (the last one is repeated)
+type fakeOAuth struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	replies []*deviceToken
+	polls   []time.Time // time of each token poll
+}
+
+// newFakeOAuth starts a fake with the token poll replies, and points the OAuth
+// helpers at it with intervals in milliseconds. The returned function restores
+// them and shuts the fake down.
+func newFakeOAuth(replies ...*deviceToken) (*fakeOAuth, func()) {
+	f := &fakeOAuth{replies: replies}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil || req.PostForm.Get("client_id") != "client" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/login/device/code":
+			json.NewEncoder(w).Encode(&deviceCode{
+				DeviceCode:      "device",
+				UserCode:        "ABCD-1234",
+				VerificationURI: "https://github.com/login/device",
+				ExpiresIn:       900,
+				Interval:        5,
+			})
+		case "/login/oauth/access_token":
+			if req.PostForm.Get("device_code") != "device" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.polls = append(f.polls, time.Now())
+			reply := f.replies[0]
+			if len(f.replies) > 1 {
+				f.replies = f.replies[1:]
+			}
+			json.NewEncoder(w).Encode(reply)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+
+	previousURL, previousUnit := oauthURL, pollUnit
+	oauthURL, pollUnit = f.URL, time.Millisecond
+	return f, func() {
+		oauthURL, pollUnit = previousURL, previousUnit
+		f.Close()
+	}
+}
+
+// pollTimes returns the times of the token polls
+func (f *fakeOAuth) pollTimes() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.polls...)
+}
+
+func TestDeviceFlowSuccess(t *testing.T) {
+	f, done := newFakeOAuth(
+		&deviceToken{Error: "authorization_pending"},
+		&deviceToken{Error: "authorization_pending"},
+		&deviceToken{AccessToken: "gho_token", Scope: "gist"},
+	)
+	defer done()
+
+	code, err := requestDeviceCode("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.UserCode != "ABCD-1234" || code.Interval != 5 {
+		t.Fatalf("device code %+v", code)
+	}
+	token, err := pollDeviceToken("client", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "gho_token" {
+		t.Fatalf("token %q, want gho_token", token)
+	}
+	if polls := len(f.pollTimes()); polls != 3 {
+		t.Fatalf("polled %d times, want 3", polls)
+	}
+}
+
+func TestDeviceFlowSlowDown(t *testing.T) {
+	f, done := newFakeOAuth(
+		&deviceToken{Error: "authorization_pending"},
+		&deviceToken{Error: "slow_down"},
+		&deviceToken{AccessToken: "gho_token"},
+	)
+	defer done()
+
+	token, err := pollDeviceToken("client", &deviceCode{DeviceCode: "device", Interval: 5})
+	if err != nil || token != "gho_token" {
+		t.Fatalf("returned %q and %v", token, err)
+	}
+	// the interval grows from 5 to 10 units after slow_down
+	polls := f.pollTimes()
+	if len(polls) != 3 {
+		t.Fatalf("polled %d times, want 3", len(polls))
+	}
+	if gap := polls[2].Sub(polls[1]); gap < 10*time.Millisecond {
+		t.Fatalf("polled %s after slow_down, want at least 10ms", gap)
+	}
+}
+
+func TestDeviceFlowExpired(t *testing.T) {
+	_, done := newFakeOAuth(&deviceToken{Error: "expired_token"})
+	_, err := pollDeviceToken("client", &deviceCode{DeviceCode: "device", Interval: 1})
+	done()
+	if err != errDeviceExpired {
+		t.Fatalf("expired_token returned %v, want errDeviceExpired", err)
+	}
+
+	// the code's lifetime is enforced even while GitHub keeps replying pending
+	_, done = newFakeOAuth(&deviceToken{Error: "authorization_pending"})
+	_, err = pollDeviceToken("client", &deviceCode{DeviceCode: "device", Interval: 1, ExpiresIn: 20})
+	done()
+	if err != errDeviceExpired {
+		t.Fatalf("lapsed code returned %v, want errDeviceExpired", err)
+	}
+}
+
+func TestDeviceFlowErrors(t *testing.T) {
+	cases := []struct {
+		reply *deviceToken
+		want  string
+	}{
+		{&deviceToken{Error: "access_denied"}, errDeviceDenied.Error()},
+		{&deviceToken{Error: "unsupported_grant_type", Description: "bad grant"}, "Error: unsupported_grant_type: bad grant"},
+		{&deviceToken{}, errBadResponse.Error()},
+	}
+	for _, tc := range cases {
+		_, done := newFakeOAuth(tc.reply)
+		_, err := pollDeviceToken("client", &deviceCode{DeviceCode: "device", Interval: 1})
+		done()
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%+v returned %v, want %s", tc.reply, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errRevisionMoved is returned when the gist was updated while it was being
+// edited
+var errRevisionMoved = errors.New("Error: the gist was updated while editing, nothing was pushed")
+
+// cmdOpen is triggered on open command. It downloads the gist's files into a
+// temporary directory, opens them in the editor, and pushes back the files
+// that were changed, added or removed in the directory. Nothing is pushed if
+// the gist's revision moved in the meantime.
+func cmdOpen(c *cli.Context) error {
+	id, err := gistArg(c, 0)
+	if err != nil {
+		return err
+	}
+	b, err := loadBackend(c)
+	if err != nil {
+		return err
+	}
+
+	g, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	original, err := remoteFiles(g)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "gist-"+g.ID)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	written := make(map[string]string) // file name to path in the directory
+	for _, name := range sortedNames(g.Files) {
+		// gist file names cannot hold directories, but the reply is not trusted;
+		// such files are left as they are
+		if filepath.Base(name) != name {
+			fmt.Printf("Leaving %s untouched, it cannot be edited locally\n", name)
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(original[name]), 0600); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		paths = append(paths, path)
+		written[name] = path
+	}
+
+	if err := runEditor(paths...); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	edited, err := localFiles(dir)
+	if err != nil {
+		fmt.Printf("Your edits are kept in %s\n", dir)
+		return err
+	}
+
+	// only the delta is sent, files removed or blanked in the editor delete the
+	// gist's file
+	patch := &patchPayload{Files: make(map[string]*filePatch)}
+	for name, content := range edited {
+		if previous, ok := original[name]; !ok || previous != content {
+			patch.Files[name] = &filePatch{Content: content}
+		}
+	}
+	for name, path := range written {
+		if _, ok := edited[name]; ok {
+			continue
+		}
+		// blank files are not read back, so keep those left as they were
+		if contents, err := ioutil.ReadFile(path); err == nil && string(contents) == original[name] {
+			continue
+		}
+		patch.Files[name] = nil
+	}
+	if len(patch.Files) == 0 {
+		os.RemoveAll(dir)
+		fmt.Printf("No changes to %s\n", g.URL)
+		return nil
+	}
+
+	// the API has no precondition on PATCH, so check the revision right before
+	current, err := b.get(g.ID)
+	if err == nil && current.revision() != g.revision() {
+		err = errRevisionMoved
+	}
+	var updated *remoteGist
+	if err == nil {
+		updated, err = b.update(g.ID, patch)
+	}
+	if err != nil {
+		fmt.Printf("Your edits are kept in %s\n", dir)
+		return err
+	}
+	os.RemoveAll(dir)
+	logUpdate(profileName(c), updated, patch, nil)
+
+	names := make([]string, 0, len(patch.Files))
+	for name := range patch.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch _, existed := original[name]; {
+		case patch.Files[name] == nil:
+			fmt.Printf("Removed %s\n", name)
+		case existed:
+			fmt.Printf("Updated %s\n", name)
+		default:
+			fmt.Printf("Added %s\n", name)
+		}
+	}
+	fmt.Println(g.URL)
+	return nil
+}
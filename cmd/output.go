@@ -0,0 +1,109 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/atotto/clipboard" // Copyright (c) 2013 Ato Araki. All rights reserved.
+	"gopkg.in/urfave/cli.v1"      // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when reporting the uploaded gist
+var (
+	errCopyAs     = errors.New("Error: unknown copy format (expected url, raw, markdown or none)")
+	errOutputFile = errors.New("Error: cannot append the result to the output file")
+)
+
+// outputSinks are the places the URL of an uploaded gist is sent to, besides
+// stdout
+type outputSinks struct {
+	copyAs     string // url, raw or markdown, or empty to not copy
+	outputFile string // file the URL is appended to, if any
+}
+
+// newOutputSinks reads the --copy, --copy-as and --output-file flags, and the
+// profile's copy setting. It may return an error.
+func newOutputSinks(c *cli.Context) (*outputSinks, error) {
+	p, err := loadProfile(c)
+	if err != nil {
+		return nil, err
+	}
+	copyAs := strings.ToLower(c.String("copy-as"))
+	if copyAs == "" {
+		copyAs = strings.ToLower(p.Copy)
+	}
+	if copyAs == "" && c.Bool("copy") {
+		copyAs = "url"
+	}
+	switch copyAs {
+	case "", "url", "raw", "markdown":
+	case "none":
+		copyAs = ""
+	default:
+		return nil, errCopyAs
+	}
+	return &outputSinks{copyAs: copyAs, outputFile: c.String("output-file")}, nil
+}
+
+// copyText returns the text copied for a gist: its URL, the raw URLs of its
+// files (one per line), or a markdown link titled by its description
+func copyText(g *remoteGist, copyAs string) string {
+	switch copyAs {
+	case "raw":
+		var urls []string
+		for _, name := range sortedNames(g.Files) {
+			if raw := g.Files[name].RawURL; raw != "" {
+				urls = append(urls, raw)
+			}
+		}
+		if len(urls) > 0 {
+			return strings.Join(urls, "\n")
+		}
+	case "markdown":
+		title := g.Description
+		if title == "" {
+			title = strings.Join(sortedNames(g.Files), ", ")
+		}
+		if title == "" {
+			title = g.URL
+		}
+		// brackets would end the link text early
+		title = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(title)
+		return fmt.Sprintf("[%s](%s)", title, g.URL)
+	}
+	return g.URL
+}
+
+// report prints the URL of an uploaded gist, appends it to the output file and
+// copies it to the clipboard. A clipboard that cannot be written is reported
+// rather than returned, as on headless machines. It may return an error.
+func (sinks *outputSinks) report(g *remoteGist) error {
+	fmt.Println(g.URL)
+
+	if sinks.outputFile != "" {
+		f, err := os.OpenFile(sinks.outputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return errOutputFile
+		}
+		_, err = fmt.Fprintln(f, g.URL)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errOutputFile
+		}
+	}
+
+	if sinks.copyAs != "" {
+		if err := clipboard.WriteAll(copyText(g, sinks.copyAs)); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to copy to the clipboard")
+		}
+	}
+	return nil
+}
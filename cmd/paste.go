@@ -0,0 +1,248 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// errors when uploading to a paste server
+var (
+	errNoPasteURL   = errors.New("Error: the paste backend needs a url in the profile")
+	errPasteTmpl    = errors.New("Error: invalid paste request template in the profile")
+	errPasteReply   = errors.New("Error: cannot find the paste URL in the server's reply")
+	errPasteOnly    = errors.New("Error: the paste backend can only create pastes")
+	errPasteRequest = errors.New("Error: the paste server rejected the upload")
+)
+
+// pasteConfig describes the requests of a paste server. The URL, headers and
+// body are Go templates executed with a pasteRequest.
+type pasteConfig struct {
+	Method   string            `json:"method,omitempty"`    // default POST
+	Headers  map[string]string `json:"headers,omitempty"`   // e.g. Authorization: Bearer {{.Token}}
+	Body     string            `json:"body,omitempty"`      // default {{json .}}
+	URLField string            `json:"url_field,omitempty"` // dotted path of the URL in a JSON reply, or the whole reply
+	IDField  string            `json:"id_field,omitempty"`  // dotted path of the ID in a JSON reply, or the URL's last segment
+}
+
+// pasteRequest is the data available to paste request templates
+type pasteRequest struct {
+	Token       string       `json:"-"`
+	Description string       `json:"description"`
+	Public      bool         `json:"public"`
+	Visibility  string       `json:"visibility"` // public or secret
+	Name        string       `json:"name"`       // first file name
+	Content     string       `json:"content"`    // first file content
+	Files       []*pasteFile `json:"files"`
+}
+
+// pasteFile is a file of a pasteRequest
+type pasteFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// pasteBackend uploads to a self-hosted paste server, with requests built from
+// the templates of the profile. Paste servers seldom allow reading back or
+// editing pastes through an API, so only uploads are supported.
+type pasteBackend struct {
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+	config  *pasteConfig
+	token   string
+}
+
+// pasteFuncs are the functions available to paste request templates
+var pasteFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		contents, err := json.Marshal(v)
+		return string(contents), err
+	},
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+}
+
+// newPasteBackend returns the paste backend configured by the profile, with its
+// templates parsed. It may return an error.
+func newPasteBackend(p *profile, token string) (*pasteBackend, error) {
+	if p.URL == "" {
+		return nil, errNoPasteURL
+	}
+	config := p.Paste
+	if config == nil {
+		config = &pasteConfig{}
+	}
+	parse := func(name, text string) (*template.Template, error) {
+		tmpl, err := template.New(name).Funcs(pasteFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errPasteTmpl
+		}
+		return tmpl, nil
+	}
+
+	b := &pasteBackend{config: config, token: token, headers: make(map[string]*template.Template)}
+	var err error
+	if b.url, err = parse("url", p.URL); err != nil {
+		return nil, err
+	}
+	body := config.Body
+	if body == "" {
+		body = "{{json .}}"
+	}
+	if b.body, err = parse("body", body); err != nil {
+		return nil, err
+	}
+	for key, value := range config.Headers {
+		if b.headers[key], err = parse(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// execute renders a template with the request data. It may return an error.
+func execute(tmpl *template.Template, data *pasteRequest) (string, error) {
+	buff := new(bytes.Buffer)
+	if err := tmpl.Execute(buff, data); err != nil {
+		return "", errPasteTmpl
+	}
+	return buff.String(), nil
+}
+
+// replyField looks up a dotted path (e.g. data.url) in a decoded JSON reply
+func replyField(reply interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := reply.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		reply = object[key]
+	}
+	switch value := reply.(type) {
+	case string:
+		return value, value != ""
+	case float64:
+		contents, _ := json.Marshal(value)
+		return string(contents), true
+	}
+	return "", false
+}
+
+func (b *pasteBackend) create(description string, public bool, files []*file) (*remoteGist, error) {
+	data := &pasteRequest{Token: b.token, Description: description, Public: public, Visibility: "secret"}
+	if public {
+		data.Visibility = "public"
+	}
+	for _, f := range files {
+		data.Files = append(data.Files, &pasteFile{Name: f.Name, Content: f.Content})
+	}
+	if len(files) > 0 {
+		data.Name, data.Content = files[0].Name, files[0].Content
+	}
+
+	target, err := execute(b.url, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := execute(b.body, data)
+	if err != nil {
+		return nil, err
+	}
+	method := b.config.Method
+	if method == "" {
+		method = "POST"
+	}
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, tmpl := range b.headers {
+		value, err := execute(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errNetwork
+	}
+	defer resp.Body.Close()
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errBadResponse
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, errBadAuth
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		if len(reply) > 0 {
+			return nil, errors.New(strings.TrimSpace(string(reply)))
+		}
+		return nil, errPasteRequest
+	}
+
+	// the reply is either JSON holding the URL, or the URL itself
+	pasteURL, id := strings.TrimSpace(string(reply)), ""
+	if b.config.URLField != "" || b.config.IDField != "" {
+		var decoded interface{}
+		if err := json.Unmarshal(reply, &decoded); err != nil {
+			return nil, errPasteReply
+		}
+		if b.config.URLField != "" {
+			pasteURL, _ = replyField(decoded, b.config.URLField)
+		}
+		if b.config.IDField != "" {
+			id, _ = replyField(decoded, b.config.IDField)
+		}
+	}
+	if pasteURL == "" || strings.ContainsAny(pasteURL, " \n") {
+		return nil, errPasteReply
+	}
+	if id == "" {
+		id = parseGistID(pasteURL)
+	}
+
+	now := time.Now().UTC()
+	g := &remoteGist{
+		ID:          id,
+		URL:         pasteURL,
+		Description: description,
+		Public:      public,
+		Files:       make(map[string]*remoteFile),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, f := range files {
+		g.Files[f.Name] = &remoteFile{Filename: f.Name, Size: len(f.Content), Content: f.Content}
+	}
+	return g, nil
+}
+
+func (b *pasteBackend) get(id string) (*remoteGist, error) {
+	return nil, errPasteOnly
+}
+
+func (b *pasteBackend) update(id string, patch *patchPayload) (*remoteGist, error) {
+	return nil, errPasteOnly
+}
+
+func (b *pasteBackend) remove(id string) error {
+	return errPasteOnly
+}
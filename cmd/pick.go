@@ -0,0 +1,253 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when picking a gist interactively
+var (
+	errPickTTY   = errors.New("Error: no gist ID has been specified (the picker needs a terminal)")
+	errPickNone  = errors.New("Error: you have no gists to pick from")
+	errPickAbort = errors.New("Error: no gist was picked")
+	errPickList  = errors.New("Error: no gist ID has been specified (the profile's backend cannot list gists to pick from)")
+)
+
+// pickPlaceholder is the argument standing for a gist to pick interactively,
+// where a gist ID is followed by other arguments
+const pickPlaceholder = "@"
+
+// gistArg returns the gist ID given as the argument at position i. When the
+// argument is missing or is the placeholder, the gist is picked interactively.
+// It may return an error.
+func gistArg(c *cli.Context, i int) (string, error) {
+	if len(c.Args()) > i && c.Args()[i] != pickPlaceholder {
+		return parseGistID(c.Args()[i]), nil
+	}
+	return pickGist(c)
+}
+
+// pickCandidate is a gist listed by the picker, with the text it is filtered on
+type pickCandidate struct {
+	gist  *remoteGist
+	label string // description and file names, as displayed
+	text  string // lowercased label, matched against the query
+	score int    // score against the current query
+}
+
+// pickGist lists the user's gists and lets them pick one with incremental fuzzy
+// filtering on descriptions and file names. It returns the picked gist ID, or
+// an error when stdin or stdout is not a terminal.
+func pickGist(c *cli.Context) (string, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return "", errPickTTY
+	}
+	b, err := loadBackend(c)
+	if err != nil {
+		return "", err
+	}
+	lb, ok := b.(listBackend)
+	if !ok {
+		return "", errPickList
+	}
+	gists, err := lb.list(0)
+	if err != nil {
+		return "", err
+	}
+	if len(gists) == 0 {
+		return "", errPickNone
+	}
+
+	candidates := make([]*pickCandidate, 0, len(gists))
+	for _, g := range gists {
+		label := strings.Join(sortedNames(g.Files), ", ")
+		if description := strings.Join(strings.Fields(g.Description), " "); description != "" {
+			label = description + "  (" + label + ")"
+		}
+		candidates = append(candidates, &pickCandidate{gist: g, label: label, text: strings.ToLower(label)})
+	}
+
+	state, err := makeRaw(os.Stdin)
+	if err != nil {
+		return "", errPickTTY
+	}
+	defer restoreTerm(os.Stdin, state)
+
+	// draw on the alternate screen, leaving the scrollback untouched
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?1049h")
+	defer func() {
+		out.WriteString("\x1b[?1049l")
+		out.Flush()
+	}()
+
+	query, selected := "", 0
+	matches := filterCandidates(candidates, query)
+	buff := make([]byte, 64)
+	for {
+		drawPicker(out, query, matches, selected, len(candidates))
+		n, err := os.Stdin.Read(buff)
+		if err != nil {
+			return "", errPickAbort
+		}
+
+		input := buff[:n]
+		switch {
+		case string(input) == "\r" || string(input) == "\n":
+			if len(matches) > 0 {
+				return matches[selected].gist.ID, nil
+			}
+		case string(input) == "\x1b" || string(input) == "\x03" || string(input) == "\x04":
+			// escape, Ctrl+C or Ctrl+D
+			return "", errPickAbort
+		case string(input) == "\x1b[A" || string(input) == "\x1bOA" || string(input) == "\x10":
+			// up arrow or Ctrl+P
+			if selected > 0 {
+				selected--
+			}
+		case string(input) == "\x1b[B" || string(input) == "\x1bOB" || string(input) == "\x0e":
+			// down arrow or Ctrl+N
+			if selected < len(matches)-1 {
+				selected++
+			}
+		case string(input) == "\x7f" || string(input) == "\x08":
+			// backspace removes the last rune of the query
+			if query != "" {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+				matches, selected = filterCandidates(candidates, query), 0
+			}
+		case string(input) == "\x15":
+			// Ctrl+U clears the query
+			query = ""
+			matches, selected = filterCandidates(candidates, query), 0
+		case input[0] != 0x1b:
+			// typed (or pasted) text, ignoring control characters
+			typed := strings.Map(func(r rune) rune {
+				if unicode.IsControl(r) {
+					return -1
+				}
+				return r
+			}, string(input))
+			if typed != "" {
+				query += typed
+				matches, selected = filterCandidates(candidates, query), 0
+			}
+		}
+	}
+}
+
+// filterCandidates returns the candidates matching every term of the query,
+// best matches first. Candidates keep their listed order (most recently
+// updated first) when scores tie.
+func filterCandidates(candidates []*pickCandidate, query string) []*pickCandidate {
+	terms := strings.Fields(strings.ToLower(query))
+	var matches []*pickCandidate
+	for _, candidate := range candidates {
+		candidate.score = 0
+		matched := true
+		for _, term := range terms {
+			score, ok := fuzzyScore(candidate.text, term)
+			if !ok {
+				matched = false
+				break
+			}
+			candidate.score += score
+		}
+		if matched {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	return matches
+}
+
+// fuzzyScore reports whether the runes of term appear in order in text, and
+// scores the match. Consecutive runes and runes starting a word score higher.
+func fuzzyScore(text, term string) (int, bool) {
+	pattern := []rune(term)
+	if len(pattern) == 0 {
+		return 0, true
+	}
+	score, next, previous := 0, 0, -2
+	runes := []rune(text)
+	for i, r := range runes {
+		if r != pattern[next] {
+			continue
+		}
+		score++
+		if i == previous+1 {
+			score += 3
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 2
+		}
+		previous = i
+		next++
+		if next == len(pattern) {
+			return score, true
+		}
+	}
+	return 0, false
+}
+
+// drawPicker renders the query line and as many matches as fit the terminal,
+// keeping the selected match in view
+func drawPicker(out *bufio.Writer, query string, matches []*pickCandidate, selected, total int) {
+	cols, rows, err := termSize(os.Stdout)
+	if err != nil || cols == 0 || rows == 0 {
+		cols, rows = 80, 24
+	}
+	visible := rows - 2
+	if visible < 1 {
+		visible = 1
+	}
+	first := 0
+	if selected >= visible {
+		first = selected - visible + 1
+	}
+
+	// raw mode disables output processing, so lines end with \r\n
+	out.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(out, "%d/%d gists (type to filter, arrows to move, enter to pick, esc to cancel)\r\n", len(matches), total)
+	for i := first; i < len(matches) && i < first+visible; i++ {
+		id := matches[i].gist.ID
+		if len(id) > 7 {
+			id = id[:7]
+		}
+		line := truncateRunes(id+"  "+matches[i].label, cols-2)
+		if i == selected {
+			fmt.Fprintf(out, "\x1b[7m> %s\x1b[0m\r\n", line)
+		} else {
+			fmt.Fprintf(out, "  %s\r\n", line)
+		}
+	}
+	fmt.Fprintf(out, "\x1b[%d;1H> %s", rows, truncateRunes(query, cols-2))
+	out.Flush()
+}
+
+// truncateRunes cuts s to at most n runes
+func truncateRunes(s string, n int) string {
+	if n < 1 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
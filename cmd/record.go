@@ -0,0 +1,263 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when recording a terminal session
+var (
+	errNoTTY = errors.New("Error: stdin is not a terminal")
+	errNoPTY = errors.New("Error: cannot allocate a pseudo-terminal")
+)
+
+// ansiEscape matches CSI, OSC and two-character escape sequences
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[ -/]*[0-~]`)
+
+// castHeader is the header line of an asciicast v2 recording
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// recorder collects the timestamped events and raw output of a session
+type recorder struct {
+	mu      sync.Mutex
+	started time.Time
+	events  bytes.Buffer // asciicast event lines
+	output  bytes.Buffer // raw output, used for the transcript
+	pending []byte       // incomplete UTF-8 sequence held for the next chunk
+}
+
+// event records an asciicast event of the given kind ("o" output, "r" resize)
+func (r *recorder) event(kind, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := math.Round(time.Since(r.started).Seconds()*1e6) / 1e6
+	line, _ := json.Marshal([]interface{}{elapsed, kind, data})
+	r.events.Write(line)
+	r.events.WriteByte('\n')
+}
+
+// write records a chunk of terminal output. Multi-byte characters split across
+// chunks are held back until complete, as events must be valid UTF-8.
+func (r *recorder) write(chunk []byte) {
+	data := append(r.pending, chunk...)
+	complete, rest := splitUTF8(data)
+	r.pending = append([]byte(nil), rest...)
+	if len(complete) == 0 {
+		return
+	}
+	r.output.Write(complete)
+	r.event("o", string(complete))
+}
+
+// splitUTF8 splits off a trailing incomplete UTF-8 sequence
+func splitUTF8(b []byte) ([]byte, []byte) {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i], b[i:]
+			}
+			break
+		}
+	}
+	return b, nil
+}
+
+// cmdRecord is triggered on record command. It runs the shell (or the given
+// command) under a pseudo-terminal, and uploads the session as an asciicast
+// with a plain-text transcript once it exits.
+func cmdRecord(c *cli.Context) error {
+	if !isTerminal(os.Stdin) {
+		return errNoTTY
+	}
+
+	args := []string(c.Args())
+	if len(args) == 0 {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		args = []string{shell}
+	}
+
+	master, slave, err := openPTY()
+	if err != nil {
+		return errNoPTY
+	}
+	defer master.Close()
+
+	cols, rows, err := termSize(os.Stdout)
+	if err != nil || cols == 0 || rows == 0 {
+		cols, rows = 80, 24
+	}
+	setTermSize(master, cols, rows)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	attachTTY(cmd)
+
+	rec := &recorder{started: time.Now()}
+	header := castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: rec.started.Unix(),
+		Command:   shellJoin(args),
+		Env: map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	}
+
+	fmt.Printf("Recording %s, exit it to upload the session\r\n", header.Command)
+	if err := cmd.Start(); err != nil {
+		slave.Close()
+		fmt.Println("Failed to run " + args[0])
+		return errRunCommand
+	}
+	// the child holds its own copy of the slave
+	slave.Close()
+
+	state, err := makeRaw(os.Stdin)
+	if err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	// keystrokes are read from a copy of stdin that can be closed once the
+	// session ends, leaving stdin to whatever runs next
+	input, stopInput, err := pollableInput(os.Stdin)
+	if err != nil {
+		restoreTerm(os.Stdin, state)
+		cmd.Process.Kill()
+		return err
+	}
+
+	// forward keystrokes and window size changes to the session
+	forwarded := make(chan struct{})
+	go func() {
+		io.Copy(master, input)
+		close(forwarded)
+	}()
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	go func() {
+		for range resize {
+			if cols, rows, err := termSize(os.Stdout); err == nil {
+				setTermSize(master, cols, rows)
+				rec.event("r", fmt.Sprintf("%dx%d", cols, rows))
+			}
+		}
+	}()
+
+	// relay output until the session closes the terminal
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := master.Read(buf)
+		if n > 0 {
+			os.Stdout.Write(buf[:n])
+			rec.write(buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+	cmd.Wait()
+	stopInput()
+	<-forwarded
+	signal.Stop(resize)
+	restoreTerm(os.Stdin, state)
+
+	headerLine, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	transcript := rec.output.String()
+	if c.Bool("keep-ansi") {
+		transcript = strings.Replace(transcript, "\r\n", "\n", -1)
+	} else {
+		transcript = plainText(transcript)
+	}
+	if strings.TrimSpace(transcript) == "" {
+		transcript = "(no output)\n"
+	}
+
+	files := []*file{
+		{
+			Name:    "session.cast",
+			Content: string(headerLine) + "\n" + rec.events.String(),
+		},
+		{
+			Name:    "session.txt",
+			Content: transcript,
+		},
+	}
+
+	fallback := fmt.Sprintf("%s session recorded %s", filepath.Base(args[0]), rec.started.Format("2006-01-02 15:04"))
+	description, err := describe(c, fallback, shellJoin(args), files)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Recording finished after %s\n", time.Since(rec.started).Round(time.Second))
+	return publish(c, description, c.Bool("public"), files)
+}
+
+// plainText renders terminal output as plain text: escape sequences are
+// removed, carriage returns and backspaces are applied, and other control
+// characters are dropped
+func plainText(output string) string {
+	output = ansiEscape.ReplaceAllString(output, "")
+
+	var text strings.Builder
+	var line []rune
+	runes := []rune(output)
+	for i, r := range runes {
+		switch {
+		case r == '\n':
+			text.WriteString(string(line))
+			text.WriteByte('\n')
+			line = line[:0]
+		case r == '\r':
+			// a bare carriage return rewrites the line from the start
+			if i+1 < len(runes) && runes[i+1] == '\n' {
+				continue
+			}
+			line = line[:0]
+		case r == '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case r == '\t' || r >= ' ' && r != 0x7f:
+			line = append(line, r)
+		}
+	}
+	text.WriteString(string(line))
+	return text.String()
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when running a command for upload
+var (
+	errNoCommand  = errors.New("Error: no command has been specified")
+	errRunCommand = errors.New("Error: cannot start command")
+	errRunOutput  = errors.New("Error: cannot capture the command's output")
+)
+
+// cmdRun is triggered on run command. It executes the command, uploads its
+// output along with a header describing the run, and returns the command's
+// exit code.
+func cmdRun(c *cli.Context) error {
+	args := c.Args()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errNoCommand
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	if c.Bool("interleave") {
+		// sharing one writer makes both streams share a single pipe, which
+		// keeps their relative order intact
+		combined := io.MultiWriter(&stdout, os.Stdout)
+		cmd.Stdout = combined
+		cmd.Stderr = combined
+	} else {
+		cmd.Stdout = io.MultiWriter(&stdout, os.Stdout)
+		cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+	}
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		fmt.Println("Failed to run " + args[0])
+		return errRunCommand
+	}
+	// a non-zero exit is reported through the process state, leaving errors
+	// copying the output
+	waitErr := cmd.Wait()
+	if _, ok := waitErr.(*exec.ExitError); ok {
+		waitErr = nil
+	}
+	duration := time.Since(started)
+
+	state := cmd.ProcessState
+	code := exitCode(state)
+	status := fmt.Sprintf("%d", code)
+	if state.ExitCode() < 0 {
+		status = state.String()
+	}
+
+	commandLine := shellJoin(args)
+	files := []*file{
+		{
+			Name:    "command.txt",
+			Content: runHeader(commandLine, status, started, duration),
+		},
+	}
+	if c.Bool("interleave") {
+		files = appendOutput(files, "output.txt", stdout.String())
+	} else {
+		files = appendOutput(files, "stdout.txt", stdout.String())
+		files = appendOutput(files, "stderr.txt", stderr.String())
+	}
+
+	description, err := describe(c, "$ "+commandLine, commandLine, files)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Uploading output of %s (exit status %s)\n", commandLine, status)
+	// the command's exit code takes precedence over a failed upload, so
+	// wrapped scripts still see their own failures
+	if err := publish(c, description, c.Bool("public"), files); err != nil {
+		if code == 0 {
+			return err
+		}
+		fmt.Println(err)
+	}
+
+	// propagate the command's exit code
+	if code != 0 {
+		return cli.NewExitError("", code)
+	}
+	if waitErr != nil {
+		return errRunOutput
+	}
+	return nil
+}
+
+// exitCode returns the exit code of a finished command. A command killed by a
+// signal exits with 128 plus the signal number, as in a shell, or 1 where the
+// signal is unknown.
+func exitCode(state *os.ProcessState) int {
+	if code := state.ExitCode(); code >= 0 {
+		return code
+	}
+	if sig, ok := exitSignal(state); ok {
+		return 128 + sig
+	}
+	return 1
+}
+
+// appendOutput adds captured output as a file, skipping empty output since
+// GitHub rejects empty files
+func appendOutput(files []*file, name, content string) []*file {
+	if content == "" {
+		return files
+	}
+	return append(files, &file{Name: name, Content: content})
+}
+
+// runHeader describes a command run: the command line, exit status, duration
+// and a summary of the environment it ran in
+func runHeader(commandLine, status string, started time.Time, duration time.Duration) string {
+	var header strings.Builder
+	fmt.Fprintf(&header, "$ %s\n\n", commandLine)
+	fmt.Fprintf(&header, "exit status: %s\n", status)
+	fmt.Fprintf(&header, "started:     %s\n", started.Format(time.RFC3339))
+	fmt.Fprintf(&header, "duration:    %s\n", duration.Round(time.Millisecond))
+	if dir, err := os.Getwd(); err == nil {
+		fmt.Fprintf(&header, "directory:   %s\n", dir)
+	}
+	host, _ := os.Hostname()
+	fmt.Fprintf(&header, "host:        %s (%s/%s)\n", host, runtime.GOOS, runtime.GOARCH)
+	if u, err := user.Current(); err == nil {
+		fmt.Fprintf(&header, "user:        %s\n", u.Username)
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		fmt.Fprintf(&header, "shell:       %s\n", shell)
+	}
+	return header.String()
+}
+
+// shellJoin joins arguments into a command line, quoting arguments that would
+// otherwise be split or expanded by a POSIX shell
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
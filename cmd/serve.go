@@ -0,0 +1,403 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when running the upload gateway
+var (
+	errNoKeys   = errors.New("Error: no client API keys have been specified (see --keys)")
+	errKeysRead = errors.New("Error: cannot read the client API keys file")
+	errLogOpen  = errors.New("Error: cannot open the access log")
+)
+
+// serveClient is a client allowed to upload through the gateway
+type serveClient struct {
+	Name        string `json:"-"`
+	Key         string `json:"key"`
+	AllowPublic bool   `json:"allow_public"` // may upload public gists, even without --allow-public
+}
+
+// secretPattern is a kind of credential the gateway refuses to upload
+type secretPattern struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+// secretPatterns are the credentials detected by the secret scan
+var secretPatterns = []*secretPattern{
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{16,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)},
+}
+
+// secretFinding is a credential found by the secret scan
+type secretFinding struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Kind string `json:"kind"`
+}
+
+// minTokenScan is the shortest gateway token searched for in uploads, so
+// placeholder tokens do not reject every upload
+const minTokenScan = 8
+
+// scanSecrets looks for credentials in the files, including the token the
+// gateway uploads with
+func scanSecrets(files []*file, token string) []*secretFinding {
+	var findings []*secretFinding
+	for _, f := range files {
+		for i, line := range strings.Split(f.Content, "\n") {
+			for _, secret := range secretPatterns {
+				if secret.pattern.MatchString(line) {
+					findings = append(findings, &secretFinding{File: f.Name, Line: i + 1, Kind: secret.kind})
+				}
+			}
+			if len(token) >= minTokenScan && strings.Contains(line, token) {
+				findings = append(findings, &secretFinding{File: f.Name, Line: i + 1, Kind: "gateway token"})
+			}
+		}
+	}
+	return findings
+}
+
+// unsafeName matches the characters replaced in uploaded file names
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._+-]+`)
+
+// cleanNames applies the naming policy: names are reduced to their base name
+// and safe characters, blank names become gistfileN.txt, and duplicates are
+// numbered, as a gist cannot hold two files of the same name
+func cleanNames(files []*file) {
+	seen := make(map[string]bool)
+	for i, f := range files {
+		name := strings.Trim(unsafeName.ReplaceAllString(path.Base(strings.Replace(f.Name, "\\", "/", -1)), "-"), "-.")
+		if name == "" {
+			name = fmt.Sprintf("gistfile%d.txt", i+1)
+		}
+		ext := path.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for n := 2; seen[name]; n++ {
+			name = fmt.Sprintf("%s-%d%s", stem, n, ext)
+		}
+		seen[name] = true
+		f.Name = name
+	}
+}
+
+// gateway is the state of the upload gateway
+type gateway struct {
+	backend     backend
+	options     *uploadOptions // shared by every upload, but for the client
+	token       string
+	clients     []*serveClient
+	maxSize     int64
+	allowPublic bool
+
+	logMu sync.Mutex
+	log   io.Writer
+}
+
+// loadClients reads the client API keys file, a JSON object of client names to
+// their settings. It may return an error.
+func loadClients(path string) ([]*serveClient, error) {
+	if path == "" {
+		return nil, errNoKeys
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errKeysRead
+	}
+	byName := make(map[string]*serveClient)
+	if err := json.Unmarshal(contents, &byName); err != nil {
+		return nil, errKeysRead
+	}
+	var clients []*serveClient
+	for name, client := range byName {
+		if client == nil || len(client.Key) < 16 {
+			return nil, fmt.Errorf("Error: the API key of client %q must be at least 16 characters", name)
+		}
+		client.Name = name
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return nil, errNoKeys
+	}
+	return clients, nil
+}
+
+// client authenticates a request by its API key, given as a bearer token or
+// in X-API-Key. It returns nil for unknown keys.
+func (gw *gateway) client(req *http.Request) *serveClient {
+	key := req.Header.Get("X-API-Key")
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key == "" {
+		return nil
+	}
+	var found *serveClient
+	for _, client := range gw.clients {
+		// every key is compared, in constant time, so timing reveals nothing
+		if subtle.ConstantTimeCompare([]byte(client.Key), []byte(key)) == 1 {
+			found = client
+		}
+	}
+	return found
+}
+
+// gatewayError is an error reply of the gateway
+type gatewayError struct {
+	Status   int              `json:"-"`
+	Message  string           `json:"error"`
+	Findings []*secretFinding `json:"findings,omitempty"`
+}
+
+// readUpload reads the files, description and visibility of an upload, from a
+// multipart form (one file per part) or from a raw body named by the name
+// parameter. It may return a gatewayError.
+func readUpload(req *http.Request) ([]*file, string, bool, *gatewayError) {
+	query := req.URL.Query()
+	description := query.Get("description")
+	public, _ := strconv.ParseBool(query.Get("public"))
+	tooLarge := &gatewayError{Status: http.StatusRequestEntityTooLarge, Message: "request body is too large"}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, "", false, tooLarge
+		}
+		return []*file{{Name: query.Get("name"), Content: string(body)}}, description, public, nil
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, "", false, &gatewayError{Status: http.StatusBadRequest, Message: "malformed multipart form"}
+	}
+	var files []*file
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", false, tooLarge
+		}
+		contents, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, "", false, tooLarge
+		}
+		switch {
+		case part.FileName() != "":
+			files = append(files, &file{Name: part.FileName(), Content: string(contents)})
+		case part.FormName() == "description":
+			description = string(contents)
+		case part.FormName() == "public":
+			public, _ = strconv.ParseBool(string(contents))
+		}
+	}
+	return files, description, public, nil
+}
+
+// ServeHTTP accepts uploads on POST /, and answers health checks on GET /.
+func (gw *gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	client := gw.client(req)
+	status, result := gw.handle(w, req, client)
+
+	name := "-"
+	if client != nil {
+		name = client.Name
+	}
+	if result == "" {
+		result = "-"
+	}
+	gw.logMu.Lock()
+	fmt.Fprintf(gw.log, "%s %s %s \"%s %s\" %d %d %s %s\n",
+		start.Format(time.RFC3339), req.RemoteAddr, name, req.Method, req.URL.Path,
+		status, req.ContentLength, time.Since(start).Round(time.Millisecond), result)
+	gw.logMu.Unlock()
+}
+
+// handle serves a request, returning the status and the uploaded URL or the
+// error message for the access log
+func (gw *gateway) handle(w http.ResponseWriter, req *http.Request, client *serveClient) (int, string) {
+	fail := func(e *gatewayError) (int, string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(e)
+		return e.Status, strconv.Quote(e.Message)
+	}
+
+	if req.URL.Path != "/" {
+		return fail(&gatewayError{Status: http.StatusNotFound, Message: "not found"})
+	}
+	if req.Method == "GET" || req.Method == "HEAD" {
+		w.WriteHeader(http.StatusOK)
+		return http.StatusOK, ""
+	}
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		return fail(&gatewayError{Status: http.StatusMethodNotAllowed, Message: "method not allowed"})
+	}
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gist"`)
+		return fail(&gatewayError{Status: http.StatusUnauthorized, Message: "missing or unknown API key"})
+	}
+	if req.ContentLength > gw.maxSize {
+		return fail(&gatewayError{Status: http.StatusRequestEntityTooLarge, Message: "request body is too large"})
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, gw.maxSize)
+
+	files, description, public, e := readUpload(req)
+	if e != nil {
+		return fail(e)
+	}
+	var kept []*file
+	for _, f := range files {
+		if strings.TrimSpace(f.Content) != "" {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == 0 {
+		return fail(&gatewayError{Status: http.StatusBadRequest, Message: "no content has been uploaded"})
+	}
+	if public && !gw.allowPublic && !client.AllowPublic {
+		return fail(&gatewayError{Status: http.StatusForbidden, Message: "public uploads are not allowed for this client"})
+	}
+	cleanNames(kept)
+	if findings := scanSecrets(kept, gw.token); len(findings) > 0 {
+		return fail(&gatewayError{Status: http.StatusUnprocessableEntity, Message: "the upload looks like it contains credentials", Findings: findings})
+	}
+
+	options := *gw.options
+	options.client = client.Name
+	created, err := uploadWith(gw.backend, &options, description, public, kept)
+	if err == errHookVeto {
+		return fail(&gatewayError{Status: http.StatusUnprocessableEntity, Message: strings.TrimPrefix(err.Error(), "Error: ")})
+	}
+	if err != nil {
+		return fail(&gatewayError{Status: http.StatusBadGateway, Message: strings.TrimPrefix(err.Error(), "Error: ")})
+	}
+
+	// pre-upload hooks may have renamed the files
+	names := sortedNames(created.Files)
+	if len(names) == 0 {
+		for _, f := range kept {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+	}
+	if strings.Contains(req.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": created.ID, "url": created.URL, "public": public, "files": names})
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintln(w, created.URL)
+	}
+	return http.StatusCreated, created.URL
+}
+
+// cmdServe is triggered on serve command. It runs an HTTP gateway accepting
+// uploads from clients holding an API key, and uploads them with the profile's
+// token and hooks, and the --expire lifetime, until interrupted.
+func cmdServe(c *cli.Context) error {
+	clients, err := loadClients(c.String("keys"))
+	if err != nil {
+		return err
+	}
+	b, err := loadBackend(c)
+	if err != nil {
+		return err
+	}
+	token, err := resolveToken(c)
+	if err != nil {
+		return err
+	}
+
+	options, err := newUploadOptions(c)
+	if err != nil {
+		return err
+	}
+	// clients expect a new gist for every upload
+	options.dedupe = dedupeOff
+
+	gw := &gateway{
+		backend:     b,
+		options:     options,
+		token:       token,
+		clients:     clients,
+		maxSize:     c.Int64("max-size"),
+		allowPublic: c.Bool("allow-public"),
+		log:         os.Stderr,
+	}
+	if path := c.String("access-log"); path != "" && path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return errLogOpen
+		}
+		defer f.Close()
+		gw.log = f
+	}
+
+	server := &http.Server{
+		Addr:              c.String("listen"),
+		Handler:           gw,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute,
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ListenAndServe()
+	}()
+	fmt.Printf("Serving uploads on http://%s for %d clients, press Ctrl+C to stop\n", server.Addr, len(clients))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	select {
+	case err := <-done:
+		return err
+	case <-interrupt:
+	}
+
+	// let uploads in flight complete
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	fmt.Println("Stopped serving")
+	return nil
+}
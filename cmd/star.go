@@ -0,0 +1,116 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// gistIDs returns the gist IDs given as arguments (IDs or URLs). Without
+// arguments, or for each placeholder, a gist is picked interactively. It may
+// return an error.
+func gistIDs(c *cli.Context) ([]string, error) {
+	if len(c.Args()) == 0 {
+		id, err := pickGist(c)
+		if err != nil {
+			return nil, err
+		}
+		return []string{id}, nil
+	}
+	ids := make([]string, 0, len(c.Args()))
+	for i := range c.Args() {
+		id, err := gistArg(c, i)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// cmdStar is triggered on star and unstar commands
+func cmdStar(c *cli.Context, star bool) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	ids, err := gistIDs(c)
+	if err != nil {
+		return err
+	}
+
+	method, done := "PUT", "Starred"
+	if !star {
+		method, done = "DELETE", "Unstarred"
+	}
+	for _, id := range ids {
+		if _, err := apiCall(method, "/gists/"+id+"/star", token, nil, nil, http.StatusNoContent); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", done, id)
+	}
+	return nil
+}
+
+// cmdIsStarred is triggered on is-starred command. Like grep, it exits with a
+// non-zero status when the gist is not starred.
+func cmdIsStarred(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	ids, err := gistIDs(c)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return errNoGistID
+	}
+	asJSON, err := jsonOutput(c)
+	if err != nil {
+		return err
+	}
+
+	// GitHub replies 204 when starred, and 404 when not
+	starred := true
+	if _, err := apiCall("GET", "/gists/"+ids[0]+"/star", token, nil, nil, http.StatusNoContent); err == errNotFound {
+		starred = false
+	} else if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if err := printJSON(map[string]interface{}{"id": ids[0], "starred": starred}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(strconv.FormatBool(starred))
+	}
+	if !starred {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+// cmdStarred is triggered on starred command. It lists the starred gists,
+// following pages up to the limit.
+func cmdStarred(c *cli.Context) error {
+	token, err := githubToken(c)
+	if err != nil {
+		return err
+	}
+	if _, err := jsonOutput(c); err != nil {
+		return err
+	}
+	gists, err := listGists(token, "/gists/starred?per_page=100", c.Int("limit"))
+	if err != nil {
+		return err
+	}
+	return printGists(c, gists)
+}
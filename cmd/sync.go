@@ -0,0 +1,447 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when syncing a directory with a gist
+var (
+	errNoGistID = errors.New("Error: no gist ID has been specified")
+	errNotBound = errors.New("Error: directory is not bound to a gist (run \"gist sync init\")")
+	errBound    = errors.New("Error: directory is already bound to a gist")
+	errSyncMeta = errors.New("Error: cannot read or write sync metadata")
+	errConflict = errors.New("Error: files changed both locally and in the gist, nothing was synced")
+	errRaced    = errors.New("Error: the gist changed during the sync, nothing was pushed (run \"gist sync\" again)")
+)
+
+// syncMetaName is the metadata file binding a directory to a gist
+const syncMetaName = ".gist-sync.json"
+
+// syncMeta records the gist a directory is bound to, and the state of both
+// sides as of the last sync
+type syncMeta struct {
+	ID       string            `json:"id"`
+	URL      string            `json:"url"`
+	Revision string            `json:"revision"` // gist revision of the last sync
+	Files    map[string]string `json:"files"`    // file name to content hash at the last sync
+}
+
+// loadSyncMeta reads the metadata of a bound directory. It may return an error.
+func loadSyncMeta(dir string) (*syncMeta, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, syncMetaName))
+	if os.IsNotExist(err) {
+		return nil, errNotBound
+	}
+	if err != nil {
+		return nil, errSyncMeta
+	}
+	var meta syncMeta
+	if err := json.Unmarshal(contents, &meta); err != nil {
+		return nil, errSyncMeta
+	}
+	if meta.Files == nil {
+		meta.Files = make(map[string]string)
+	}
+	return &meta, nil
+}
+
+// save writes the metadata of a bound directory. It may return an error.
+func (meta *syncMeta) save(dir string) error {
+	contents, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return errSyncMeta
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, syncMetaName), contents, 0644); err != nil {
+		return errSyncMeta
+	}
+	return nil
+}
+
+// contentHash returns the hex SHA-256 of content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// localFiles reads the regular files of a bound directory, excluding the
+// metadata file. Blank files are treated as absent, as gists cannot hold them.
+// It returns file names mapped to content, or an error.
+func localFiles(dir string) (map[string]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errFileRead
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || entry.Name() == syncMetaName {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			fmt.Println("Failed to read " + entry.Name())
+			return nil, errFileRead
+		}
+		if strings.TrimSpace(string(contents)) != "" {
+			files[entry.Name()] = string(contents)
+		}
+	}
+	return files, nil
+}
+
+// remoteFiles returns the gist's file names mapped to their full content. It
+// may return an error.
+func remoteFiles(g *remoteGist) (map[string]string, error) {
+	files := make(map[string]string)
+	for name, f := range g.Files {
+		content, err := f.content()
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+// syncableFiles drops the gist files whose names cannot be files of the
+// directory, reporting them as skipped. Names are not checked by every backend,
+// and one holding a directory would be written outside of it.
+func syncableFiles(remote map[string]string) map[string]string {
+	names := make([]string, 0, len(remote))
+	for name := range remote {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make(map[string]string)
+	for _, name := range names {
+		if name == "." || name == ".." || name == syncMetaName || filepath.Base(name) != name {
+			fmt.Printf("Skipping %s, it cannot be synced as a local file\n", name)
+			continue
+		}
+		files[name] = remote[name]
+	}
+	return files
+}
+
+// syncDir returns the directory argument at position i, defaulting to the
+// working directory
+func syncDir(c *cli.Context, i int) string {
+	if len(c.Args()) > i {
+		return c.Args()[i]
+	}
+	return "."
+}
+
+// cmdSyncInit is triggered on sync init command. It binds a directory to a
+// gist and downloads the gist's files into it.
+func cmdSyncInit(c *cli.Context) error {
+	dir := syncDir(c, 1)
+	if _, err := loadSyncMeta(dir); err != errNotBound {
+		if err == nil {
+			return errBound
+		}
+		return err
+	}
+
+	id, err := gistArg(c, 0)
+	if err != nil {
+		return err
+	}
+	b, err := loadBackend(c)
+	if err != nil {
+		return err
+	}
+	g, err := b.get(id)
+	if err != nil {
+		return err
+	}
+	remote, err := remoteFiles(g)
+	if err != nil {
+		return err
+	}
+	remote = syncableFiles(remote)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	meta := &syncMeta{ID: g.ID, URL: g.URL, Revision: g.revision(), Files: make(map[string]string)}
+	for name, content := range remote {
+		path := filepath.Join(dir, name)
+		if existing, err := ioutil.ReadFile(path); err == nil && string(existing) != content {
+			// leave differing local files for the first sync to report, with no
+			// base so neither side wins
+			fmt.Printf("Keeping local %s, it differs from the gist\n", name)
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+		meta.Files[name] = contentHash(content)
+		fmt.Printf("Pulled %s\n", name)
+	}
+	if err := meta.save(dir); err != nil {
+		return err
+	}
+	fmt.Printf("Bound %s to %s\n", dir, g.URL)
+	return nil
+}
+
+// syncAction is what a sync does with a single file
+type syncAction int
+
+// valid values for syncAction
+const (
+	syncNone       syncAction = 0 // unchanged, or changed identically on both sides
+	syncPush       syncAction = 1 // changed locally only
+	syncPull       syncAction = 2 // changed in the gist only
+	syncConflicted syncAction = 3 // changed differently on both sides
+)
+
+// planSync decides what to do with a file from its content hash as of the last
+// sync, locally and in the gist. An empty hash means the file does not exist.
+func planSync(base, local, remote string) syncAction {
+	localChanged := local != base
+	remoteChanged := remote != base
+	switch {
+	case localChanged && remoteChanged && local != remote:
+		return syncConflicted
+	case localChanged && !remoteChanged:
+		return syncPush
+	case remoteChanged && !localChanged:
+		return syncPull
+	}
+	return syncNone
+}
+
+// cmdSync is triggered on sync command. It computes what changed locally and
+// in the gist since the last sync, pushes and pulls accordingly, and refuses to
+// sync when both sides changed the same file.
+func cmdSync(c *cli.Context) error {
+	dir := syncDir(c, 0)
+	meta, err := loadSyncMeta(dir)
+	if err != nil {
+		return err
+	}
+	b, err := loadBackend(c)
+	if err != nil {
+		return err
+	}
+
+	local, err := localFiles(dir)
+	if err != nil {
+		return err
+	}
+	g, err := b.get(meta.ID)
+	if err != nil {
+		return err
+	}
+	remote, err := remoteFiles(g)
+	if err != nil {
+		return err
+	}
+	remote = syncableFiles(remote)
+
+	// every file known to either side or the last sync
+	names := make(map[string]bool)
+	for _, files := range []map[string]string{meta.Files, local, remote} {
+		for name := range files {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	hash := func(files map[string]string, name string) string {
+		if content, ok := files[name]; ok {
+			return contentHash(content)
+		}
+		return ""
+	}
+
+	var pushes, pulls, conflicts []string
+	for _, name := range sorted {
+		switch planSync(meta.Files[name], hash(local, name), hash(remote, name)) {
+		case syncPush:
+			pushes = append(pushes, name)
+		case syncPull:
+			pulls = append(pulls, name)
+		case syncConflicted:
+			conflicts = append(conflicts, name)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		printConflicts(b, meta, g, local, remote, conflicts)
+		return errConflict
+	}
+	if len(pushes) == 0 && len(pulls) == 0 {
+		fmt.Printf("%s is up to date with %s\n", dir, meta.URL)
+		return nil
+	}
+	if c.Bool("dry-run") {
+		for _, name := range pushes {
+			fmt.Printf("Would push %s\n", name)
+		}
+		for _, name := range pulls {
+			fmt.Printf("Would pull %s\n", name)
+		}
+		return nil
+	}
+
+	// pull first, so a failed push leaves nothing half applied remotely
+	for _, name := range pulls {
+		path := filepath.Join(dir, name)
+		content, ok := remote[name]
+		if !ok {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			fmt.Printf("Pulled deletion of %s\n", name)
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Pulled %s\n", name)
+	}
+
+	revision := g.revision()
+	if len(pushes) > 0 {
+		patch := &patchPayload{Files: make(map[string]*filePatch)}
+		for _, name := range pushes {
+			if content, ok := local[name]; ok {
+				patch.Files[name] = &filePatch{Content: content}
+			} else {
+				patch.Files[name] = nil
+			}
+		}
+		// the gist may have been edited since it was fetched
+		if changed, err := gistChanged(b, g); err != nil {
+			return err
+		} else if changed {
+			return errRaced
+		}
+		updated, err := b.update(meta.ID, patch)
+		if err != nil {
+			return err
+		}
+		sources := make(map[string]string)
+		for _, name := range pushes {
+			sources[name] = filepath.Join(dir, name)
+		}
+		logUpdate(profileName(c), updated, patch, sources)
+		revision = updated.revision()
+		for _, name := range pushes {
+			if patch.Files[name] == nil {
+				fmt.Printf("Pushed deletion of %s\n", name)
+			} else {
+				fmt.Printf("Pushed %s\n", name)
+			}
+		}
+	}
+
+	// both sides now hold the local state
+	synced, err := localFiles(dir)
+	if err != nil {
+		return err
+	}
+	meta.Revision = revision
+	meta.Files = make(map[string]string)
+	for name, content := range synced {
+		meta.Files[name] = contentHash(content)
+	}
+	return meta.save(dir)
+}
+
+// gistChanged reports whether a gist no longer matches a fetched copy, by its
+// revision, or by its files when the backend keeps no revisions. It may return
+// an error.
+func gistChanged(b backend, g *remoteGist) (bool, error) {
+	fresh, err := b.get(g.ID)
+	if err != nil {
+		return false, err
+	}
+	if g.revision() != "" || fresh.revision() != "" {
+		return fresh.revision() != g.revision(), nil
+	}
+	before, err := remoteFiles(g)
+	if err != nil {
+		return false, err
+	}
+	after, err := remoteFiles(fresh)
+	if err != nil {
+		return false, err
+	}
+	if len(before) != len(after) {
+		return true, nil
+	}
+	for name, content := range before {
+		if other, ok := after[name]; !ok || other != content {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// printConflicts prints a three-way report of each conflicting file, showing
+// the local, last synced and gist versions
+func printConflicts(b backend, meta *syncMeta, g *remoteGist, local, remote map[string]string, conflicts []string) {
+	// the last synced content is fetched from the recorded revision, when the
+	// backend serves past revisions
+	base := make(map[string]string)
+	if rb, ok := b.(revisionBackend); ok && meta.Revision != "" {
+		if old, err := rb.revision(meta.ID, meta.Revision); err == nil {
+			if files, err := remoteFiles(old); err == nil {
+				base = files
+			}
+		}
+	}
+
+	version := func(files map[string]string, name string) string {
+		content, ok := files[name]
+		if !ok {
+			return "(deleted)\n"
+		}
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content
+	}
+	short := func(revision string) string {
+		if len(revision) > 7 {
+			return revision[:7]
+		}
+		return revision
+	}
+
+	for _, name := range conflicts {
+		fmt.Printf("CONFLICT %s: changed locally and in the gist since revision %s\n", name, short(meta.Revision))
+		fmt.Printf("<<<<<<< local\n%s", version(local, name))
+		baseVersion := version(base, name)
+		if _, synced := meta.Files[name]; !synced {
+			baseVersion = "(never synced)\n"
+		} else if _, ok := base[name]; !ok && meta.Files[name] != "" {
+			baseVersion = "(cannot fetch revision)\n"
+		}
+		fmt.Printf("||||||| base (%s)\n%s", short(meta.Revision), baseVersion)
+		fmt.Printf("=======\n%s", version(remote, name))
+		fmt.Printf(">>>>>>> gist (%s)\n\n", short(g.revision()))
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import "testing"
+
+func TestSyncableFiles(t *testing.T) {
+	files := syncableFiles(map[string]string{
+		"notes.md":     "kept",
+		"../escape.sh": "skipped",
+		"dir/file.txt": "skipped",
+		"..":           "skipped",
+		syncMetaName:   "skipped",
+	})
+	if len(files) != 1 || files["notes.md"] != "kept" {
+		t.Fatalf("syncable files %v, want only notes.md", files)
+	}
+}
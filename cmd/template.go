@@ -0,0 +1,225 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when expanding description and name templates
+var (
+	errDescTmpl = errors.New("Error: invalid description template")
+	errNameTmpl = errors.New("Error: invalid file name template")
+)
+
+// templateData is the data available to description and file name templates.
+// The fields describing a file are those of the file being named, or of the
+// first file for descriptions. Git details are looked up only when used.
+type templateData struct {
+	Now     time.Time // time of the upload, for custom layouts
+	Command string    // command run by gist run, or the gist command line
+	Default string    // description given by git, run or record, if any
+	Name    string    // original file name
+	Base    string    // original file name without its extension
+	Ext     string    // extension of the original file name, with its dot
+	Index   int       // position of the file, from 1
+}
+
+// Date returns the date of the upload, as 2006-01-02
+func (d *templateData) Date() string {
+	return d.Now.Format("2006-01-02")
+}
+
+// Time returns the time of the upload, as 15:04:05
+func (d *templateData) Time() string {
+	return d.Now.Format("15:04:05")
+}
+
+// Hostname returns the name of the machine
+func (d *templateData) Hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// User returns the name of the current user
+func (d *templateData) User() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Cwd returns the working directory
+func (d *templateData) Cwd() string {
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// Dir returns the base name of the working directory
+func (d *templateData) Dir() string {
+	return filepath.Base(d.Cwd())
+}
+
+// templateRepo is the repository of the working directory, looked up once
+var templateRepo *repoInfo
+
+// repo returns the repository of the working directory, or an empty one
+// outside a repository
+func (d *templateData) repo() *repoInfo {
+	if templateRepo == nil {
+		templateRepo = &repoInfo{}
+		// git's stderr is not wanted outside a repository
+		if insideRepo() {
+			if r, err := currentRepo(); err == nil {
+				templateRepo = r
+			}
+		}
+	}
+	return templateRepo
+}
+
+// insideRepo reports whether the working directory is in a git work tree,
+// without printing git's errors
+func insideRepo() bool {
+	dir, err := os.Getwd()
+	for err == nil {
+		if _, statErr := os.Stat(filepath.Join(dir, ".git")); statErr == nil {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	return false
+}
+
+// Repo returns the name of the git repository
+func (d *templateData) Repo() string {
+	return d.repo().Name
+}
+
+// Branch returns the checked out git branch
+func (d *templateData) Branch() string {
+	return d.repo().Branch
+}
+
+// SHA returns the full SHA of the git HEAD
+func (d *templateData) SHA() string {
+	return d.repo().Head
+}
+
+// ShortSHA returns the abbreviated SHA of the git HEAD
+func (d *templateData) ShortSHA() string {
+	head := d.repo().Head
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	return head
+}
+
+// newTemplateData returns the template data of an upload, describing the file
+// with the original name at position index (from 1). An empty command stands
+// for the gist command line.
+func newTemplateData(command, name string, index int) *templateData {
+	if command == "" {
+		command = shellJoin(append([]string{appName}, os.Args[1:]...))
+	}
+	ext := filepath.Ext(name)
+	return &templateData{
+		Now:     time.Now(),
+		Command: command,
+		Name:    name,
+		Base:    strings.TrimSuffix(name, ext),
+		Ext:     ext,
+		Index:   index,
+	}
+}
+
+// expandTemplate executes text as a Go template with the data. Text without
+// actions is returned as is. It returns false if the template is invalid.
+func expandTemplate(text string, data *templateData) (string, bool) {
+	if !strings.Contains(text, "{{") {
+		return text, true
+	}
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return "", false
+	}
+	var buff bytes.Buffer
+	if err := tmpl.Execute(&buff, data); err != nil {
+		return "", false
+	}
+	return buff.String(), true
+}
+
+// describe returns the description of an upload: --description, else the
+// fallback of git, run or record, else the profile's description template,
+// expanded as a template with the fallback as .Default. Command is the command
+// run by gist run, if any. It may return an error.
+func describe(c *cli.Context, fallback, command string, files []*file) (string, error) {
+	description := gistDescription
+	if description == "" && fallback == "" {
+		p, err := loadProfile(c)
+		if err != nil {
+			return "", err
+		}
+		description = p.DescriptionTemplate
+	}
+	if description == "" {
+		return fallback, nil
+	}
+	name := ""
+	if len(files) > 0 {
+		name = files[0].Name
+	}
+	data := newTemplateData(command, name, 1)
+	data.Default = fallback
+	expanded, ok := expandTemplate(description, data)
+	if !ok {
+		return "", errDescTmpl
+	}
+	return expanded, nil
+}
+
+// overrideAt returns the file name override at position i, if any
+func overrideAt(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return ""
+}
+
+// nameFile returns the name of the file with the original name at position
+// index (from 1): the --name override, else the profile's name template, else
+// the original name, expanded as a template. It may return an error.
+func nameFile(c *cli.Context, override, original string, index int) (string, error) {
+	name := override
+	if name == "" {
+		p, err := loadProfile(c)
+		if err != nil {
+			return "", err
+		}
+		name = p.NameTemplate
+	}
+	if name == "" {
+		return original, nil
+	}
+	expanded, ok := expandTemplate(name, newTemplateData("", original, index))
+	if !ok || strings.TrimSpace(expanded) == "" {
+		return "", errNameTmpl
+	}
+	return expanded, nil
+}
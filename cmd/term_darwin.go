@@ -0,0 +1,52 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// termios ioctl requests
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
+
+// openPTY allocates a pseudo-terminal, returning its master and slave ends. It
+// may return an error.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// grant and unlock the slave, then look up its name
+	if err := ioctl(master.Fd(), syscall.TIOCPTYGRANT, 0); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if err := ioctl(master.Fd(), syscall.TIOCPTYUNLK, 0); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	var name [128]byte
+	if err := ioctl(master.Fd(), syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		slave, err := os.OpenFile(string(name[:i]), os.O_RDWR|syscall.O_NOCTTY, 0)
+		if err != nil {
+			master.Close()
+			return nil, nil, err
+		}
+		return master, slave, nil
+	}
+	master.Close()
+	return nil, nil, errNoTTY
+}
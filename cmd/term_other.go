@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package gist
+
+import (
+	"os"
+	"os/exec"
+)
+
+// termState is the saved state of a terminal, unused on this platform
+type termState struct{}
+
+// isTerminal reports whether the file is a terminal, which is never detected
+// on this platform
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+// makeRaw is unsupported on this platform
+func makeRaw(f *os.File) (*termState, error) {
+	return nil, errNoTTY
+}
+
+// restoreTerm is unsupported on this platform
+func restoreTerm(f *os.File, state *termState) error {
+	return errNoTTY
+}
+
+// termSize is unsupported on this platform
+func termSize(f *os.File) (int, int, error) {
+	return 0, 0, errNoTTY
+}
+
+// setTermSize is unsupported on this platform
+func setTermSize(f *os.File, cols, rows int) error {
+	return errNoTTY
+}
+
+// openPTY is unsupported on this platform
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errNoPTY
+}
+
+// attachTTY is unsupported on this platform
+func attachTTY(cmd *exec.Cmd) {}
+
+// notifyResize is unsupported on this platform
+func notifyResize(ch chan<- os.Signal) {}
+
+// pollableInput is unsupported on this platform
+func pollableInput(f *os.File) (*os.File, func(), error) {
+	return nil, nil, errNoTTY
+}
+
+// exitSignal is unsupported on this platform
+func exitSignal(state *os.ProcessState) (int, bool) {
+	return 0, false
+}
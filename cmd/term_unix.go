@@ -0,0 +1,130 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || linux
+// +build darwin linux
+
+package gist
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// termState is the saved state of a terminal, used to restore it after raw mode
+type termState struct {
+	termios syscall.Termios
+}
+
+// ioctl performs an ioctl request on a file descriptor
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	return ioctl(f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&termios))) == nil
+}
+
+// makeRaw puts the terminal into raw mode, returning its previous state. It may
+// return an error.
+func makeRaw(f *os.File) (*termState, error) {
+	var state termState
+	if err := ioctl(f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&state.termios))); err != nil {
+		return nil, errNoTTY
+	}
+
+	// same settings as cfmakeraw(3)
+	raw := state.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&raw))); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// restoreTerm restores a terminal to a state saved by makeRaw
+func restoreTerm(f *os.File, state *termState) error {
+	return ioctl(f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&state.termios)))
+}
+
+// winsize is the kernel's terminal window size structure
+type winsize struct {
+	Rows   uint16
+	Cols   uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+// termSize returns the number of columns and rows of the terminal. It may
+// return an error.
+func termSize(f *os.File) (int, int, error) {
+	var ws winsize
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Cols), int(ws.Rows), nil
+}
+
+// setTermSize sets the number of columns and rows of the terminal
+func setTermSize(f *os.File, cols, rows int) error {
+	ws := winsize{Rows: uint16(rows), Cols: uint16(cols)}
+	return ioctl(f.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// attachTTY makes the command start in a new session with the terminal as its
+// controlling terminal
+func attachTTY(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+	}
+}
+
+// notifyResize relays terminal window size changes to the channel
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
+
+// pollableInput returns a copy of the file whose reads end when it is closed,
+// and a function closing it and restoring the file's blocking mode. It may
+// return an error.
+func pollableInput(f *os.File) (*os.File, func(), error) {
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, nil, err
+	}
+	// the copy shares the file's mode, which is restored once closed
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+	in := os.NewFile(uintptr(fd), f.Name())
+	return in, func() {
+		in.Close()
+		syscall.SetNonblock(int(f.Fd()), false)
+	}, nil
+}
+
+// exitSignal returns the number of the signal that killed the process, if any
+func exitSignal(state *os.ProcessState) (int, bool) {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return int(status.Signal()), true
+}
@@ -8,9 +8,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
 )
@@ -20,8 +23,22 @@ var (
 	errNetwork     = errors.New("Error: cannot send request to GitHub")
 	errBadResponse = errors.New("Error: cannot read reply from GitHub")
 	errBadAuth     = errors.New("Error: invalid API token")
+	errNoToken     = errors.New("Error: no API token has been specified")
+	errExpired     = errors.New("Error: API token has expired")
+	errNoScope     = errors.New("Error: API token is missing the gist scope")
+	errSSO         = errors.New("Error: API token is not authorized for the organization's SAML single sign-on")
 )
 
+// apiURL is the root of GitHub's API. It can be overridden with the
+// GIST_API_URL environment variable (e.g. for GitHub Enterprise).
+var apiURL = "https://api.github.com"
+
+func init() {
+	if url := os.Getenv("GIST_API_URL"); url != "" {
+		apiURL = strings.TrimSuffix(url, "/")
+	}
+}
+
 // inputType is an enum for the type of input modes
 type inputType int
 
@@ -31,13 +48,17 @@ const (
 	modeGlobs     inputType = 1 // globs are being provided
 	modeClipboard inputType = 2 // clipboard is being used
 	modeError     inputType = 3 // no input is provided (error must be triggered)
+	modeEditor    inputType = 4 // content is composed in the editor
 )
 
 // checkInputMode takes the cli arguments and determines the input type
-func checkInputMode(args cli.Args, clip bool) inputType {
+func checkInputMode(args cli.Args, clip, edit bool) inputType {
 	if clip {
 		return modeClipboard
 	}
+	if edit {
+		return modeEditor
+	}
 	if len(args) == 0 {
 		stat, _ := os.Stdin.Stat()
 		if (stat.Mode() & os.ModeCharDevice) == 0 {
@@ -52,6 +73,7 @@ func checkInputMode(args cli.Args, clip bool) inputType {
 type file struct {
 	Name    string
 	Content string
+	Source  string // path the content was read from, if any
 }
 
 // payload is the structure for POST GitHub requests
@@ -91,29 +113,21 @@ func jsonBuilder(description string, public bool, files []*file) (*bytes.Buffer,
 	return buff, nil
 }
 
-// githubResponse is used for parsing GitHub's request reply
-type githubResponse struct {
-	URL string `json:"html_url"`
-}
-
 // sendContent takes the formatted payload with a token and sends the request to
-// GitHub's API. It will return a URL string or an error.
-func sendContent(payload *bytes.Buffer, token string) (string, error) {
+// GitHub's API. It will return the created gist or an error.
+func sendContent(payload *bytes.Buffer, token string) (*remoteGist, error) {
 	if token == "" {
-		return "", errBadAuth
+		return nil, errNoToken
 	}
 
-	url := "https://api.github.com/gists"
-	req, err := http.NewRequest("POST", url, payload)
+	req, err := newRequest("POST", "/gists", token, payload)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	req.Header.Set("Authorization", "token "+token)
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", errNetwork
+		return nil, errNetwork
 	}
 	defer resp.Body.Close()
 
@@ -121,22 +135,94 @@ func sendContent(payload *bytes.Buffer, token string) (string, error) {
 	case "201 Created":
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return "", errBadResponse
+			return nil, errBadResponse
 		}
-		var data githubResponse
+		var data remoteGist
 		if err := json.Unmarshal(body, &data); err != nil {
-			return "", errBadResponse
+			return nil, errBadResponse
 		}
-		return data.URL, nil
+		return &data, nil
 
-	case "401 Unauthorized":
-		return "", errBadAuth
+	case "401 Unauthorized", "403 Forbidden", "404 Not Found":
+		// GitHub replies 404 when the token lacks the gist scope
+		if err := authError(resp); err != nil {
+			return nil, err
+		}
 	}
 
 	// uncommon error encountered
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", errBadResponse
+		return nil, errBadResponse
+	}
+	return nil, errors.New(string(body))
+}
+
+// newRequest creates a request for the given API path, authenticated with the
+// provided token.
+func newRequest(method, path, token string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, apiURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// authError inspects a rejected response and returns the most specific
+// authentication error explaining it. It returns nil if the response does not
+// look like an authentication problem.
+func authError(resp *http.Response) error {
+	if resp.Header.Get("X-GitHub-SSO") != "" {
+		return errSSO
+	}
+	if expiry, ok := tokenExpiry(resp.Header); ok && time.Now().After(expiry) {
+		return errExpired
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errBadAuth
+	}
+	// classic tokens report their scopes on every response
+	if scopes, ok := resp.Header["X-Oauth-Scopes"]; ok && !hasGistScope(strings.Join(scopes, ",")) {
+		return errNoScope
+	}
+	return nil
+}
+
+// tokenExpiryLayouts are the layouts GitHub has used for token expiry dates
+var tokenExpiryLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700",
+}
+
+// tokenExpiry returns the expiry GitHub reports for fine-grained and expiring
+// tokens, if present and readable.
+func tokenExpiry(header http.Header) (time.Time, bool) {
+	value := header.Get("GitHub-Authentication-Token-Expiration")
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range tokenExpiryLayouts {
+		if expiry, err := time.Parse(layout, value); err == nil {
+			return expiry, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hasGistScope reports whether a comma separated scope list grants access to
+// gists.
+func hasGistScope(scopes string) bool {
+	for _, scope := range strings.Split(scopes, ",") {
+		if strings.TrimSpace(scope) == "gist" {
+			return true
+		}
 	}
-	return "", errors.New(string(body))
+	return false
 }
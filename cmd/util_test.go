@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	want := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, value := range []string{"2026-01-02 15:04:05 UTC", "2026-01-02 10:04:05 -0500"} {
+		header := http.Header{}
+		header.Set("GitHub-Authentication-Token-Expiration", value)
+		expiry, ok := tokenExpiry(header)
+		if !ok || !expiry.Equal(want) {
+			t.Errorf("%q parsed as %s (%t), want %s", value, expiry, ok, want)
+		}
+	}
+	for _, value := range []string{"", "next tuesday"} {
+		header := http.Header{}
+		header.Set("GitHub-Authentication-Token-Expiration", value)
+		if _, ok := tokenExpiry(header); ok {
+			t.Errorf("%q parsed as an expiry", value)
+		}
+	}
+}
+
+func TestCheckAuthExpiry(t *testing.T) {
+	var expiration string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if expiration != "" {
+			w.Header().Set("GitHub-Authentication-Token-Expiration", expiration)
+		}
+		w.Write([]byte(`{"login": "octocat"}`))
+	}))
+	defer srv.Close()
+	previous := apiURL
+	apiURL = srv.URL
+	defer func() { apiURL = previous }()
+
+	for _, tc := range []struct {
+		expiration string
+		want       string
+	}{
+		{"", ""},
+		{"next tuesday", "unknown"},
+		{"2026-01-02 15:04:05 UTC", time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC).Local().Format("2006-01-02 15:04:05 MST")},
+	} {
+		expiration = tc.expiration
+		status, err := checkAuth("token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Expires != tc.want {
+			t.Errorf("expiration %q reported as %q, want %q", tc.expiration, status.Expires, tc.want)
+		}
+	}
+}
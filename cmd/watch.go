@@ -0,0 +1,217 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/urfave/cli.v1" // Copyright (c) 2016 Jeremy Saenz. All rights reserved.
+)
+
+// errors when watching files
+var (
+	errWatchInput = errors.New("Error: only files can be watched")
+	errWatch      = errors.New("Error: cannot watch files for changes")
+)
+
+const (
+	debounceDelay = 300 * time.Millisecond // quiet period before syncing changes
+	pollInterval  = 500 * time.Millisecond // how often the polling watcher checks files
+)
+
+// watcher reports the paths of watched files as they change
+type watcher interface {
+	Changes() <-chan string
+	Close() error
+}
+
+// watch uploads the files, then keeps the gist in sync with them until
+// interrupted. Changes are debounced, and only files whose content changed are
+// sent. It may return an error.
+func watch(c *cli.Context, description string, public bool, files []*file) error {
+	sinks, err := newOutputSinks(c)
+	if err != nil {
+		return err
+	}
+	b, err := loadBackend(c)
+	if err != nil {
+		return err
+	}
+	opts, err := newUploadOptions(c)
+	if err != nil {
+		return err
+	}
+	created, err := uploadWatched(b, opts, description, public, files)
+	if err != nil {
+		return err
+	}
+	if err := sinks.report(created); err != nil {
+		return err
+	}
+
+	// last synced content and gist file name of each source
+	synced := make(map[string]*file)
+	var sources []string
+	for _, f := range files {
+		synced[f.Source] = f
+		sources = append(sources, f.Source)
+	}
+
+	w, err := newWatcher(sources)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	fmt.Println("Watching for changes, press Ctrl+C to stop")
+
+	pending := make(map[string]bool)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case path, ok := <-w.Changes():
+			if !ok {
+				return errWatch
+			}
+			pending[path] = true
+			debounce = time.After(debounceDelay)
+
+		case <-debounce:
+			syncChanges(b, profileName(c), created.ID, synced, pending)
+			pending = make(map[string]bool)
+			debounce = nil
+
+		case <-interrupt:
+			fmt.Println("Stopped watching " + created.URL)
+			return nil
+		}
+	}
+}
+
+// uploadWatched uploads the files to be watched. The gist is always new, as
+// an identical one found in the history would then be edited by every save. It
+// returns the created gist or an error.
+func uploadWatched(b backend, opts *uploadOptions, description string, public bool, files []*file) (*remoteGist, error) {
+	watched := *opts
+	watched.dedupe = dedupeOff
+	return uploadWith(b, &watched, description, public, files)
+}
+
+// syncChanges sends the changed files to the gist and prints a line describing
+// the sync. Failures are printed rather than returned, so watching continues.
+func syncChanges(b backend, profile, id string, synced map[string]*file, changed map[string]bool) {
+	patch := &patchPayload{Files: make(map[string]*filePatch)}
+	sources := make(map[string]string)
+	var names []string
+	for path := range changed {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Skipping %s: cannot read file\n", path)
+			continue
+		}
+		f := synced[path]
+		if string(contents) == f.Content {
+			continue
+		}
+		if len(contents) == 0 {
+			// GitHub would delete an emptied file
+			fmt.Printf("Skipping %s: file is empty\n", path)
+			continue
+		}
+		patch.Files[f.Name] = &filePatch{Content: string(contents)}
+		sources[f.Name] = path
+		names = append(names, f.Name)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	updated, err := b.update(id, patch)
+	if err != nil {
+		fmt.Printf("Failed to sync at %s: %s\n", time.Now().Format("15:04:05"), err)
+		return
+	}
+	logUpdate(profile, updated, patch, sources)
+	for _, f := range synced {
+		if p, ok := patch.Files[f.Name]; ok {
+			f.Content = p.Content
+		}
+	}
+	sort.Strings(names)
+	fmt.Printf("Synced %s at %s\n", strings.Join(names, ", "), time.Now().Format("15:04:05"))
+}
+
+// pollWatcher detects changes by periodically comparing the modification time
+// and size of files. It is used where filesystem notifications are not
+// available.
+type pollWatcher struct {
+	changes chan string
+	done    chan struct{}
+	once    sync.Once
+}
+
+// newPollWatcher starts polling the files for changes
+func newPollWatcher(paths []string) *pollWatcher {
+	w := &pollWatcher{
+		changes: make(chan string),
+		done:    make(chan struct{}),
+	}
+
+	stamp := func(path string) string {
+		info, err := os.Stat(path)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+	}
+	last := make(map[string]string)
+	for _, path := range paths {
+		last[path] = stamp(path)
+	}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, path := range paths {
+					if current := stamp(path); current != last[path] {
+						last[path] = current
+						select {
+						case w.changes <- path:
+						case <-w.done:
+							return
+						}
+					}
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+func (w *pollWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *pollWatcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyWatcher detects changes with inotify. Parent directories are watched
+// rather than the files themselves, so files replaced by editors (written to a
+// temporary file and renamed) keep being tracked.
+type inotifyWatcher struct {
+	changes chan string
+	done    chan struct{}
+	fd      *os.File
+}
+
+// newWatcher starts watching the files for changes, falling back to polling if
+// inotify is unavailable
+func newWatcher(paths []string) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return newPollWatcher(paths), nil
+	}
+	w := &inotifyWatcher{
+		changes: make(chan string),
+		done:    make(chan struct{}),
+		fd:      os.NewFile(uintptr(fd), "inotify"),
+	}
+
+	// absolute path of each watched file, mapped to the path it was given as
+	watched := make(map[string]string)
+	dirs := make(map[int32]string)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		watched[abs] = path
+		dir := filepath.Dir(abs)
+		mask := uint32(syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE)
+		wd, err := syscall.InotifyAddWatch(fd, dir, mask)
+		if err != nil {
+			w.Close()
+			return newPollWatcher(paths), nil
+		}
+		dirs[int32(wd)] = dir
+	}
+
+	go func() {
+		defer close(w.changes)
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := w.fd.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				name := strings.TrimRight(string(buf[start:start+int(event.Len)]), "\x00")
+				offset = start + int(event.Len)
+
+				if path, ok := watched[filepath.Join(dirs[event.Wd], name)]; ok {
+					select {
+					case w.changes <- path:
+					case <-w.done:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *inotifyWatcher) Close() error {
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	return w.fd.Close()
+}
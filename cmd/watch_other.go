@@ -0,0 +1,13 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package gist
+
+// newWatcher starts polling the files for changes
+func newWatcher(paths []string) (watcher, error) {
+	return newPollWatcher(paths), nil
+}
@@ -37,6 +37,109 @@ Once you have a token, you should set the "GIST_KEY" environment variable to the
 token value. If you do not want to use an environment variable, you will have to
 copy and paste the token each time you would like to upload content.
 
+Alternatively, run "gist auth login" to authorize gist with the OAuth device
+flow. The client ID of your OAuth app is passed with --client-id (or
+GIST_CLIENT_ID), and the resulting token is stored in the configuration file
+(~/.config/gist/config.json, or GIST_CONFIG). Several accounts can be kept side
+by side with --profile (or GIST_PROFILE).
+
+A profile can upload to GitLab snippets instead of GitHub gists. Set its
+"backend" to "gitlab" in the configuration file, with a GitLab access token
+(api scope) as its "token". Uploads are personal snippets unless "project"
+names a project (ID or path). Public uploads are public snippets, and secret
+uploads are private unless "secret_visibility" is "internal":
+
+    {
+      "profiles": {
+        "work": {
+          "backend": "gitlab",
+          "url": "https://gitlab.example.com",
+          "token": "glpat-...",
+          "project": "platform/runbooks",
+          "secret_visibility": "internal"
+        }
+      }
+    }
+
+For air-gapped environments, the "local" backend stores gists in the profile's
+"dir", one directory per gist holding a gist.json manifest, the current files,
+and every revision (secret gists are readable by you only). The "paste" backend
+uploads to a paste server with a request built from Go templates: "url", and
+"paste.headers" and "paste.body" (JSON of the upload by default) are executed
+with .Token, .Description, .Public, .Visibility (public or secret), .Name and
+.Content (of the first file), and .Files, plus the json and base64 functions.
+The reply is the paste URL, or JSON holding it at "paste.url_field" (e.g.
+data.url):
+
+    {
+      "profiles": {
+        "offline": { "backend": "local", "dir": "/srv/gists" },
+        "paste": {
+          "backend": "paste",
+          "url": "https://paste.internal/api/{{.Visibility}}",
+          "token": "...",
+          "paste": {
+            "method": "POST",
+            "headers": { "Authorization": "Bearer {{.Token}}" },
+            "body": "{\"title\": {{json .Description}}, \"text\": {{json .Content}}}",
+            "url_field": "data.url"
+          }
+        }
+      }
+    }
+
+Uploads, open, sync and --watch work with the GitHub, GitLab and local backends
+(paste servers only take uploads), and so does the picker when no gist ID is
+given. Stars, forks, comments and the index are GitHub features, and fail with
+other backends.
+
+Every upload, update and deletion made from this machine is appended to the
+history (~/.config/gist/history.jsonl), with the gist's URL and visibility, the
+profile, and the name, source path and SHA-256 of each file (never the content
+itself). gist log searches and exports it.
+
+Descriptions (--description) and file names (--name) are Go templates, with
+{{.Hostname}}, {{.User}}, {{.Date}}, {{.Time}} (or {{.Now.Format ...}}),
+{{.Repo}}, {{.Branch}}, {{.SHA}} and {{.ShortSHA}} of the current git
+repository, {{.Cwd}} and {{.Dir}} (its base name), {{.Command}} (the command of
+gist run, or the gist command line), {{.Default}} (the description gist git,
+gist run and gist record give otherwise), and the original file's {{.Name}},
+{{.Base}}, {{.Ext}} and {{.Index}}. Write {{"{{"}} for a literal {{. A
+profile's description_template labels every upload given no description that
+gist git, gist run and gist record do not describe themselves, and its
+name_template names the files of public and secret uploads given no names:
+
+    {
+      "profiles": {
+        "ci": {
+          "description_template": "{{.Repo}}@{{.ShortSHA}} on {{.Hostname}}: {{.Command}}",
+          "name_template": "{{.Base}}-{{.Date}}{{.Ext}}"
+        }
+      }
+    }
+
+A profile's hooks run executables around uploads, from the command line and
+through gist serve. Each pre hook receives the pending upload as JSON on stdin
+(event, profile, description, public, and files with their name, content and
+source), and may print the same JSON with a changed description or files
+(printing nothing keeps the upload as is). A non-zero exit rejects the upload.
+Each post hook receives the created gist's id, url, description, public and file
+names, with reused set when an identical gist was returned instead; its failures
+are reported but the gist is kept. Hooks are told the event in GIST_HOOK, and
+are stopped after timeout (30s by default):
+
+    {
+      "profiles": {
+        "default": {
+          "hooks": {
+            "pre": ["/usr/local/libexec/gist/license-header", "/usr/local/libexec/gist/lint"],
+            "post": ["/usr/local/libexec/gist/notify"],
+            "timeout": "10s"
+          }
+        }
+      }
+    }
+
 Usage
 
 Global usage:
@@ -57,6 +160,25 @@ Global usage:
     COMMANDS:
         public, p   upload one or more public files
         secret, s   upload one or more secret files (shh! it's a secret)
+        run, r      run a command and upload its output as a secret gist
+        record      record a terminal session and upload it as an asciicast
+        git         upload diffs, patches and changed files from the current git repository
+        sync        two-way sync a directory bound to a gist
+        open        edit a gist's files in $VISUAL or $EDITOR and push back the changes
+        star        star one or more gists
+        unstar      unstar one or more gists
+        starred     list your starred gists
+        is-starred  check whether a gist is starred (exits 1 if not)
+        fork        fork a gist into your account
+        forks       list the forks of a gist
+        comment     list, add, edit and delete gist comments
+        serve       run an HTTP gateway that uploads on behalf of clients holding an API key
+        reap        delete the gists uploaded with --expire whose time is up
+        log         show the history of gists uploaded, updated and deleted from this machine
+        index       fetch your gists into the local index for offline search
+        search      search the local index offline
+        cache       manage the on-disk HTTP cache
+        auth, a     log in to GitHub and inspect the API token
         license, l  show licensing information
         help, h     Shows a list of commands or help for one command
 
@@ -74,10 +196,18 @@ Upload usage (same for secret uploads):
     gist public [command options] [arguments...]
 
     OPTIONS:
-    --token value, -t value        required GitHub Gist access token [$GIST_KEY]
+    --token value, -t value        GitHub Gist access token (defaults to the profile's stored login) [$GIST_KEY]
+    --profile value                configuration profile to use (default "default") [$GIST_PROFILE]
+    --expire value                 delete the gist after this long (e.g. 30m, 24h or 7d) when reap runs
+    --force-new                    upload even if an identical gist already exists
+    --copy                         copy the gist's URL to the clipboard
+    --copy-as value                copy the URL, raw URL or a markdown link: url, raw, markdown or none (default the profile's copy)
+    --output-file value            file to append the gist's URL to
     --clipboard, -c                read from clipboard
+    --editor, -e                   compose the file (and description) in $VISUAL or $EDITOR
     --name value, -n value         comma separated file name override for Gist
     --description value, -d value  gist description
+    --watch, -w                    keep the gist in sync with the files until interrupted
 
 Aliases
 
@@ -91,6 +221,7 @@ The flags also have short aliases:
 
     -t / --token
     -c / --clipboard
+    -e / --editor
     -n / --name
     -d / --description
 
@@ -126,9 +257,105 @@ The interface behaves the way it looks:
     # upload from clipboard
     gist p -c
 
+    # write a new file in $VISUAL/$EDITOR (named main.go for syntax highlighting;
+    # the description can be edited in the header, and an empty file aborts)
+    gist s -e -n=main.go
+
+    # upload, then push every change to the same gist until Ctrl+C
+    gist s incident.md server.log -w
+
+    # run a command and upload its stdout, stderr and exit status (exits with
+    # the command's exit code, or 128 plus the signal that killed it, even if the
+    # upload fails; a successful command whose upload fails exits with 1)
+    gist run -- make test
+    gist run --interleave --public -- go test ./...
+
+    # record a shell session, uploaded as session.cast and session.txt on exit
+    gist record
+
+    # share git changes (repository, branch and HEAD go in the description)
+    gist git diff
+    gist git staged
+    gist git range origin/master..HEAD
+    gist git files HEAD~2
+
+    # bind a directory to a gist, then push and pull changes (conflicting edits
+    # on both sides are reported and nothing is synced)
+    gist sync init aa5a315d61ae9438b18d notes/
+    gist sync notes/
+
+    # edit a gist's files in $VISUAL/$EDITOR; only changed, added and removed
+    # files are pushed, and nothing is if the gist was updated in the meantime
+    gist open aa5a315d61ae9438b18d
+
+    # leave out the gist ID to pick one of your gists interactively, filtering
+    # on descriptions and file names as you type ("@" stands for the picked gist
+    # when other arguments follow)
+    gist open
+    gist sync init @ notes/
+
+    # star gists by ID or URL, and list the starred ones
+    gist star https://gist.github.com/octocat/aa5a315d61ae9438b18d
+    gist starred --limit=0 --format=json
+
+    # fork a teammate's gist, and list who else forked it
+    gist fork aa5a315d61ae9438b18d
+    gist forks aa5a315d61ae9438b18d
+
+    # read the comments of a gist, and reply (the text comes from the arguments,
+    # stdin, or $VISUAL/$EDITOR when neither is given)
+    gist comment list aa5a315d61ae9438b18d
+    gist comment add aa5a315d61ae9438b18d "Works on macOS too, thanks!"
+    gist comment edit aa5a315d61ae9438b18d 1234567
+
+    # run an upload gateway for CI jobs and teammates without a token; keys.json
+    # maps each client to {"key": "...", "allow_public": false}, uploads with
+    # credentials in them are rejected; the profile's hooks run and --expire
+    # applies to every upload, and each upload creates a new gist
+    gist serve --listen=127.0.0.1:8080 --keys=keys.json --access-log=gateway.log
+    curl -H "Authorization: Bearer $KEY" --data-binary @build.log "http://127.0.0.1:8080/?name=build.log"
+
+    # upload a debug paste that deletes itself after a day (the deadline is added
+    # to the description); reap deletes what is due (run it from cron)
+    gist secret --expire=24h debug.log
+    gist reap --dry-run
+
+    # uploading files identical to a gist uploaded from this machine (same
+    # description, names, content and visibility) prints the existing gist
+    # instead of creating another one; set "dedupe" in a profile to "remote" to
+    # also search your 100 most recent gists on GitHub, or to "off" (--watch and
+    # --expire always create a new gist)
+    gist secret build/report.html
+    gist secret --force-new build/report.html
+
+    # copy a markdown link to the new gist (set "copy" in a profile to always
+    # copy), and keep a list of what a CI job uploaded
+    gist secret --copy-as=markdown notes.md
+    gist secret --output-file=uploads.txt build/*.log
+
+    # look back at what was shared, and export a week of secret uploads
+    gist log --file=deploy.sh
+    gist log --action=upload --visibility=secret --since=7d --limit=0 --format=json
+
+    # index your gists (incrementally after the first run), then search offline
+    gist index
+    gist search nginx config
+    gist search --in=files,description --format=json dockerfile
+
+    # inspect or clear the HTTP cache (replies are revalidated with ETags, and
+    # 304s do not count against the rate limit; GIST_NO_HTTP_CACHE disables it)
+    gist cache stats
+    gist cache clear
+
+    # log in with the OAuth device flow instead of a personal access token
+    gist auth login --client-id="Iv1.abc123..."
+
+    # check the token's login, scopes and expiry
+    gist auth status
+
 If single or multiple files are being provided, and there are no file name
-overrides, the original file names will be used. For stdin and the clipboard, if
-no name is provided, the file will be uploaded as gistfile1.txt.
+overrides, the original file names will be used. For stdin, the clipboard and
+the editor, if no name is provided, the file will be uploaded as gistfile1.txt.
 
 License
 
@@ -0,0 +1,724 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gisttest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reply is a response being prepared by a handler
+type reply struct {
+	status int
+	body   interface{} // encoded as JSON, unless it is a []byte
+	header http.Header
+}
+
+// call is the context of a request being served
+type call struct {
+	req   *http.Request
+	token *token // nil when anonymous
+	parts []string
+}
+
+// login returns the authenticated user, or an empty string
+func (c *call) login() string {
+	if c.token == nil {
+		return ""
+	}
+	return c.token.login
+}
+
+// canWrite reports whether the token has the gist scope
+func (c *call) canWrite() bool {
+	if c.token == nil {
+		return false
+	}
+	for _, scope := range c.token.scopes {
+		if scope == "gist" {
+			return true
+		}
+	}
+	return false
+}
+
+// message returns a reply with a GitHub style error message
+func message(status int, text string) *reply {
+	return &reply{status: status, body: map[string]string{
+		"message":           text,
+		"documentation_url": "https://docs.github.com/rest",
+	}}
+}
+
+// notFound is GitHub's reply to missing resources, and to writes without the
+// gist scope
+func notFound() *reply {
+	return message(http.StatusNotFound, "Not Found")
+}
+
+// serveHTTP serves a request: injected failures first, then authentication,
+// rate limiting and routing. Every request is logged.
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &call{req: req, parts: strings.Split(strings.Trim(req.URL.Path, "/"), "/")}
+	r := s.route(c)
+
+	s.requests = append(s.requests, &Request{
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Login:  c.login(),
+		Status: r.status,
+	})
+	s.write(w, req, r)
+}
+
+// route picks the reply to a request. The caller holds the lock.
+func (s *Server) route(c *call) *reply {
+	if r := s.failure(c.req); r != nil {
+		return r
+	}
+
+	// a rejected token fails every request, while anonymous requests can read
+	if value := requestToken(c.req); value != "" {
+		t, ok := s.tokens[value]
+		if !ok {
+			return message(http.StatusUnauthorized, "Bad credentials")
+		}
+		c.token = t
+	}
+
+	if s.now().After(s.rateReset) {
+		s.rateUsed, s.rateReset = 0, s.now().Add(time.Hour)
+	}
+	if s.rateUsed >= s.rateLimit {
+		r := message(http.StatusForbidden, "API rate limit exceeded")
+		r.header = s.rateHeader()
+		return r
+	}
+	s.rateUsed++
+
+	r := s.dispatch(c)
+	if r.header == nil {
+		r.header = make(http.Header)
+	}
+	for key, values := range s.rateHeader() {
+		r.header[key] = values
+	}
+	if c.token != nil {
+		r.header.Set("X-OAuth-Scopes", strings.Join(c.token.scopes, ", "))
+	}
+	return r
+}
+
+// dispatch routes a request to its endpoint. The caller holds the lock.
+func (s *Server) dispatch(c *call) *reply {
+	method, parts := c.req.Method, c.parts
+	switch {
+	case len(parts) == 1 && parts[0] == "user" && method == "GET":
+		if c.token == nil {
+			return message(http.StatusUnauthorized, "Requires authentication")
+		}
+		return &reply{status: http.StatusOK, body: map[string]interface{}{"login": c.login(), "type": "User"}}
+
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "gists" && method == "GET":
+		login := parts[1]
+		return s.list(c, s.sorted(func(g *Gist) bool {
+			return g.Owner == login && (g.Public || g.Owner == c.login())
+		}))
+
+	case len(parts) == 4 && parts[0] == "raw" && method == "GET":
+		return s.raw(parts[1], parts[2], parts[3])
+
+	case len(parts) == 0 || parts[0] != "gists":
+		return notFound()
+
+	case len(parts) == 1 && method == "GET":
+		if c.token == nil {
+			return s.list(c, s.sorted(func(g *Gist) bool { return g.Public }))
+		}
+		return s.list(c, s.sorted(func(g *Gist) bool { return g.Owner == c.login() }))
+
+	case len(parts) == 1 && method == "POST":
+		return s.createGist(c)
+
+	case len(parts) == 2 && parts[1] == "public" && method == "GET":
+		return s.list(c, s.sorted(func(g *Gist) bool { return g.Public }))
+
+	case len(parts) == 2 && parts[1] == "starred" && method == "GET":
+		if c.token == nil {
+			return message(http.StatusUnauthorized, "Requires authentication")
+		}
+		return s.list(c, s.sorted(func(g *Gist) bool { return g.Stars[c.login()] }))
+
+	case len(parts) == 1:
+		return notFound()
+	}
+
+	g, ok := s.gists[parts[1]]
+	if !ok {
+		return notFound()
+	}
+	switch {
+	case len(parts) == 2 && method == "GET":
+		return &reply{status: http.StatusOK, body: s.render(g, g.History[0], true)}
+	case len(parts) == 2 && method == "PATCH":
+		return s.updateGist(c, g)
+	case len(parts) == 2 && method == "DELETE":
+		if !c.canWrite() || g.Owner != c.login() {
+			return notFound()
+		}
+		delete(s.gists, g.ID)
+		return &reply{status: http.StatusNoContent}
+
+	case len(parts) == 3 && parts[2] == "star":
+		return s.star(c, g)
+	case len(parts) == 3 && parts[2] == "forks" && method == "GET":
+		return s.list(c, s.sorted(func(fork *Gist) bool { return fork.ForkOf == g.ID }))
+	case len(parts) == 3 && parts[2] == "forks" && method == "POST":
+		if !c.canWrite() {
+			return notFound()
+		}
+		if g.Owner == c.login() {
+			return message(http.StatusUnprocessableEntity, "You cannot fork your own gist")
+		}
+		fork := s.create(c.login(), g.Description, g.Public, g.Files, g.ID)
+		return &reply{status: http.StatusCreated, body: s.render(fork, fork.History[0], false)}
+	case len(parts) == 3 && parts[2] == "commits" && method == "GET":
+		return s.commits(c, g)
+	case len(parts) >= 3 && parts[2] == "comments":
+		return s.comments(c, g)
+
+	case len(parts) == 3 && method == "GET":
+		for _, revision := range g.History {
+			if revision.Version == parts[2] {
+				return &reply{status: http.StatusOK, body: s.render(g, revision, true)}
+			}
+		}
+	}
+	return notFound()
+}
+
+// failure returns the reply of the first injected failure matching the
+// request, consuming it. The caller holds the lock.
+func (s *Server) failure(req *http.Request) *reply {
+	for i, f := range s.failures {
+		if f.Method != "" && f.Method != req.Method {
+			continue
+		}
+		if f.Path != "" && !strings.HasPrefix(req.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		r := &reply{status: f.Status, header: make(http.Header)}
+		if f.Body != "" {
+			r.body = []byte(f.Body)
+		} else {
+			r.body = message(f.Status, http.StatusText(f.Status)).body
+		}
+		for key, values := range f.Header {
+			r.header[key] = values
+		}
+		return r
+	}
+	return nil
+}
+
+// requestToken extracts the token of the Authorization header, in either the
+// token or the bearer scheme
+func requestToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	for _, scheme := range []string{"token ", "Bearer ", "bearer "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimSpace(auth[len(scheme):])
+		}
+	}
+	return ""
+}
+
+// rateHeader returns the rate limit headers. The caller holds the lock.
+func (s *Server) rateHeader() http.Header {
+	remaining := s.rateLimit - s.rateUsed
+	if remaining < 0 {
+		remaining = 0
+	}
+	header := make(http.Header)
+	header.Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Used", strconv.Itoa(s.rateUsed))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(s.rateReset.Unix(), 10))
+	header.Set("X-RateLimit-Resource", "core")
+	return header
+}
+
+// write sends a reply. Successful GET replies carry an ETag, and a matching
+// If-None-Match yields 304 as on GitHub.
+func (s *Server) write(w http.ResponseWriter, req *http.Request, r *reply) {
+	var body []byte
+	switch b := r.body.(type) {
+	case nil:
+	case []byte:
+		body = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = encoded
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	for key, values := range r.header {
+		w.Header()[key] = values
+	}
+
+	if req.Method == "GET" && r.status == http.StatusOK {
+		sum := sha256.Sum256(body)
+		etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.WriteHeader(r.status)
+	w.Write(body)
+}
+
+// decode reads the JSON body of a request into v
+func decode(req *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// list replies with a page of gists, without file content, with GitHub's
+// page, per_page and since parameters and Link header. The caller holds the
+// lock.
+func (s *Server) list(c *call, gists []*Gist) *reply {
+	query := c.req.URL.Query()
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return message(http.StatusUnprocessableEntity, "Invalid since parameter")
+		}
+		var updated []*Gist
+		for _, g := range gists {
+			if !g.UpdatedAt.Before(t) {
+				updated = append(updated, g)
+			}
+		}
+		gists = updated
+	}
+
+	page := make([]interface{}, 0)
+	r := &reply{status: http.StatusOK, header: make(http.Header)}
+	first, last := s.paginate(c, len(gists), r.header)
+	for _, g := range gists[first:last] {
+		page = append(page, s.render(g, g.History[0], false))
+	}
+	r.body = page
+	return r
+}
+
+// paginate returns the bounds of the requested page among total items, and
+// sets the Link header of the reply. The caller holds the lock.
+func (s *Server) paginate(c *call, total int, header http.Header) (int, int) {
+	query := c.req.URL.Query()
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 30
+	}
+	if perPage > 100 {
+		perPage = 100
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pages := (total + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	link := func(n int, rel string) string {
+		q := c.req.URL.Query()
+		q.Set("page", strconv.Itoa(n))
+		q.Set("per_page", strconv.Itoa(perPage))
+		return fmt.Sprintf(`<%s%s?%s>; rel="%s"`, s.URL, c.req.URL.Path, q.Encode(), rel)
+	}
+	var links []string
+	if page < pages {
+		links = append(links, link(page+1, "next"), link(pages, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+	if len(links) > 0 {
+		header.Set("Link", strings.Join(links, ", "))
+	}
+
+	first := (page - 1) * perPage
+	if first > total {
+		first = total
+	}
+	last := first + perPage
+	if last > total {
+		last = total
+	}
+	return first, last
+}
+
+// createGist serves POST /gists. The caller holds the lock.
+func (s *Server) createGist(c *call) *reply {
+	if c.token == nil {
+		return message(http.StatusUnauthorized, "Requires authentication")
+	}
+	if !c.canWrite() {
+		return notFound()
+	}
+	var in struct {
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+		Files       map[string]*struct {
+			Content string `json:"content"`
+		} `json:"files"`
+	}
+	if err := decode(c.req, &in); err != nil {
+		return message(http.StatusBadRequest, "Problems parsing JSON")
+	}
+	files := make(map[string]string)
+	for name, f := range in.Files {
+		if f == nil || strings.TrimSpace(f.Content) == "" {
+			return message(http.StatusUnprocessableEntity, "Validation Failed: contents can't be blank")
+		}
+		files[name] = f.Content
+	}
+	if len(files) == 0 {
+		return message(http.StatusUnprocessableEntity, "Validation Failed: files can't be blank")
+	}
+	g := s.create(c.login(), in.Description, in.Public, files, "")
+	return &reply{status: http.StatusCreated, body: s.render(g, g.History[0], true)}
+}
+
+// updateGist serves PATCH /gists/:id, with GitHub's semantics: a null file
+// deletes it, a filename renames it, and blank content deletes it. The caller
+// holds the lock.
+func (s *Server) updateGist(c *call, g *Gist) *reply {
+	if !c.canWrite() || g.Owner != c.login() {
+		return notFound()
+	}
+	var in struct {
+		Description *string `json:"description"`
+		Files       map[string]*struct {
+			Content  *string `json:"content"`
+			Filename *string `json:"filename"`
+		} `json:"files"`
+	}
+	if err := decode(c.req, &in); err != nil {
+		return message(http.StatusBadRequest, "Problems parsing JSON")
+	}
+
+	previous := copyFiles(g.Files)
+	files := copyFiles(g.Files)
+	for name, f := range in.Files {
+		content, exists := files[name]
+		if f == nil {
+			delete(files, name)
+			continue
+		}
+		if f.Content != nil {
+			content = *f.Content
+		} else if !exists {
+			return message(http.StatusUnprocessableEntity, "Validation Failed: contents can't be blank")
+		}
+		delete(files, name)
+		if f.Filename != nil && *f.Filename != "" {
+			name = *f.Filename
+		}
+		if strings.TrimSpace(content) != "" {
+			files[name] = content
+		}
+	}
+	if len(files) == 0 {
+		return message(http.StatusUnprocessableEntity, "Validation Failed: files can't be blank")
+	}
+
+	if in.Description != nil {
+		g.Description = *in.Description
+	}
+	g.Files = files
+	g.UpdatedAt = s.now().UTC().Truncate(time.Second)
+	s.commit(g, c.login(), previous)
+	return &reply{status: http.StatusOK, body: s.render(g, g.History[0], true)}
+}
+
+// star serves GET, PUT and DELETE /gists/:id/star. The caller holds the lock.
+func (s *Server) star(c *call, g *Gist) *reply {
+	if c.token == nil {
+		return message(http.StatusUnauthorized, "Requires authentication")
+	}
+	switch c.req.Method {
+	case "GET":
+		if g.Stars[c.login()] {
+			return &reply{status: http.StatusNoContent}
+		}
+		return notFound()
+	case "PUT", "DELETE":
+		if !c.canWrite() {
+			return notFound()
+		}
+		if c.req.Method == "PUT" {
+			g.Stars[c.login()] = true
+		} else {
+			delete(g.Stars, c.login())
+		}
+		return &reply{status: http.StatusNoContent}
+	}
+	return notFound()
+}
+
+// commits serves GET /gists/:id/commits. The caller holds the lock.
+func (s *Server) commits(c *call, g *Gist) *reply {
+	r := &reply{status: http.StatusOK, header: make(http.Header)}
+	first, last := s.paginate(c, len(g.History), r.header)
+	page := make([]interface{}, 0)
+	for _, revision := range g.History[first:last] {
+		page = append(page, map[string]interface{}{
+			"url":          s.URL + "/gists/" + g.ID + "/" + revision.Version,
+			"version":      revision.Version,
+			"user":         user(revision.User),
+			"committed_at": revision.CommittedAt,
+			"change_status": map[string]int{
+				"total":     revision.Additions + revision.Deletions,
+				"additions": revision.Additions,
+				"deletions": revision.Deletions,
+			},
+		})
+	}
+	r.body = page
+	return r
+}
+
+// comments serves the comment endpoints of a gist. The caller holds the lock.
+func (s *Server) comments(c *call, g *Gist) *reply {
+	parts := c.parts
+	if len(parts) == 3 {
+		switch c.req.Method {
+		case "GET":
+			r := &reply{status: http.StatusOK, header: make(http.Header)}
+			first, last := s.paginate(c, len(g.Comments), r.header)
+			page := make([]interface{}, 0)
+			for _, comment := range g.Comments[first:last] {
+				page = append(page, s.renderComment(g, comment))
+			}
+			r.body = page
+			return r
+		case "POST":
+			if !c.canWrite() {
+				return notFound()
+			}
+			var in struct {
+				Body string `json:"body"`
+			}
+			if err := decode(c.req, &in); err != nil {
+				return message(http.StatusBadRequest, "Problems parsing JSON")
+			}
+			if strings.TrimSpace(in.Body) == "" {
+				return message(http.StatusUnprocessableEntity, "Validation Failed: body can't be blank")
+			}
+			s.sequence++
+			now := s.now().UTC().Truncate(time.Second)
+			comment := &Comment{ID: s.sequence, User: c.login(), Body: in.Body, CreatedAt: now, UpdatedAt: now}
+			g.Comments = append(g.Comments, comment)
+			return &reply{status: http.StatusCreated, body: s.renderComment(g, comment)}
+		}
+		return notFound()
+	}
+
+	if len(parts) != 4 {
+		return notFound()
+	}
+	for i, comment := range g.Comments {
+		if strconv.FormatInt(comment.ID, 10) != parts[3] {
+			continue
+		}
+		switch c.req.Method {
+		case "GET":
+			return &reply{status: http.StatusOK, body: s.renderComment(g, comment)}
+		case "PATCH":
+			if !c.canWrite() || comment.User != c.login() {
+				return notFound()
+			}
+			var in struct {
+				Body string `json:"body"`
+			}
+			if err := decode(c.req, &in); err != nil {
+				return message(http.StatusBadRequest, "Problems parsing JSON")
+			}
+			if strings.TrimSpace(in.Body) == "" {
+				return message(http.StatusUnprocessableEntity, "Validation Failed: body can't be blank")
+			}
+			comment.Body = in.Body
+			comment.UpdatedAt = s.now().UTC().Truncate(time.Second)
+			return &reply{status: http.StatusOK, body: s.renderComment(g, comment)}
+		case "DELETE":
+			// the gist's owner can delete any comment
+			if !c.canWrite() || (comment.User != c.login() && g.Owner != c.login()) {
+				return notFound()
+			}
+			g.Comments = append(g.Comments[:i], g.Comments[i+1:]...)
+			return &reply{status: http.StatusNoContent}
+		}
+	}
+	return notFound()
+}
+
+// raw serves the full content of a file at a revision, as its raw_url. The
+// caller holds the lock.
+func (s *Server) raw(id, version, name string) *reply {
+	g, ok := s.gists[id]
+	if !ok {
+		return notFound()
+	}
+	for _, revision := range g.History {
+		if content, ok := revision.Files[name]; ok && revision.Version == version {
+			return &reply{status: http.StatusOK, body: []byte(content), header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}}}
+		}
+	}
+	return notFound()
+}
+
+// user renders an account
+func user(login string) map[string]interface{} {
+	return map[string]interface{}{"login": login, "type": "User"}
+}
+
+// render encodes a gist at a revision as GitHub does. File content (possibly
+// truncated) and history are only included for single gists. The caller holds
+// the lock.
+func (s *Server) render(g *Gist, revision *Revision, full bool) map[string]interface{} {
+	files := make(map[string]interface{})
+	for name, content := range revision.Files {
+		f := map[string]interface{}{
+			"filename": name,
+			"type":     "text/plain",
+			"language": language(name),
+			"raw_url":  s.URL + "/raw/" + g.ID + "/" + revision.Version + "/" + name,
+			"size":     len(content),
+		}
+		if full {
+			truncated := s.truncateAt > 0 && len(content) > s.truncateAt
+			if truncated {
+				content = content[:s.truncateAt]
+			}
+			f["truncated"] = truncated
+			f["content"] = content
+		}
+		files[name] = f
+	}
+
+	out := map[string]interface{}{
+		"url":          s.URL + "/gists/" + g.ID,
+		"forks_url":    s.URL + "/gists/" + g.ID + "/forks",
+		"commits_url":  s.URL + "/gists/" + g.ID + "/commits",
+		"id":           g.ID,
+		"html_url":     "https://gist.github.com/" + g.ID,
+		"git_pull_url": "https://gist.github.com/" + g.ID + ".git",
+		"description":  g.Description,
+		"public":       g.Public,
+		"owner":        user(g.Owner),
+		"files":        files,
+		"comments":     len(g.Comments),
+		"created_at":   g.CreatedAt,
+		"updated_at":   g.UpdatedAt,
+		"truncated":    false,
+	}
+	if full {
+		var history []interface{}
+		for _, r := range g.History {
+			history = append(history, map[string]interface{}{
+				"url":          s.URL + "/gists/" + g.ID + "/" + r.Version,
+				"version":      r.Version,
+				"user":         user(r.User),
+				"committed_at": r.CommittedAt,
+				"change_status": map[string]int{
+					"total":     r.Additions + r.Deletions,
+					"additions": r.Additions,
+					"deletions": r.Deletions,
+				},
+			})
+		}
+		out["history"] = history
+		var forks []interface{}
+		for _, fork := range s.sorted(func(fork *Gist) bool { return fork.ForkOf == g.ID }) {
+			forks = append(forks, map[string]interface{}{
+				"id":         fork.ID,
+				"url":        s.URL + "/gists/" + fork.ID,
+				"user":       user(fork.Owner),
+				"created_at": fork.CreatedAt,
+				"updated_at": fork.UpdatedAt,
+			})
+		}
+		out["forks"] = forks
+	}
+	return out
+}
+
+// renderComment encodes a comment as GitHub does
+func (s *Server) renderComment(g *Gist, comment *Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         comment.ID,
+		"url":        s.URL + "/gists/" + g.ID + "/comments/" + strconv.FormatInt(comment.ID, 10),
+		"body":       comment.Body,
+		"user":       user(comment.User),
+		"created_at": comment.CreatedAt,
+		"updated_at": comment.UpdatedAt,
+	}
+}
+
+// languages maps common file extensions to GitHub's language names
+var languages = map[string]string{
+	".c":    "C",
+	".cpp":  "C++",
+	".css":  "CSS",
+	".go":   "Go",
+	".html": "HTML",
+	".java": "Java",
+	".js":   "JavaScript",
+	".json": "JSON",
+	".md":   "Markdown",
+	".py":   "Python",
+	".rb":   "Ruby",
+	".rs":   "Rust",
+	".sh":   "Shell",
+	".ts":   "TypeScript",
+	".yaml": "YAML",
+	".yml":  "YAML",
+}
+
+// language returns the language of a file name, or nil when unknown
+func language(name string) interface{} {
+	if lang, ok := languages[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+	return nil
+}
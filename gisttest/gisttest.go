@@ -0,0 +1,361 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gisttest provides an in-process fake of GitHub's Gist API, for
+// testing code that talks to api.github.com without reaching it.
+//
+// The fake implements creating, reading, updating, deleting and listing gists,
+// stars, forks, commits and comments. It checks tokens and their scopes,
+// paginates listings with Link headers, sends rate limit headers and ETags, and
+// can be told to fail requests. Its clock can be replaced with SetClock:
+//
+//	srv := gisttest.NewServer()
+//	defer srv.Close()
+//	srv.AddToken("secret-token", "octocat")
+//	srv.Fail(gisttest.Failure{Method: "POST", Path: "/gists", Status: 502})
+//	// point the client at srv.URL instead of https://api.github.com
+package gisttest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Gist is a gist stored by the fake
+type Gist struct {
+	ID          string
+	Owner       string
+	Description string
+	Public      bool
+	Files       map[string]string // file name to content
+	History     []*Revision       // most recent first
+	Comments    []*Comment
+	Stars       map[string]bool // logins that starred the gist
+	ForkOf      string          // ID of the forked gist, if any
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	order int64 // creation order, as creation times are in seconds
+}
+
+// Revision is a commit of a gist
+type Revision struct {
+	Version     string
+	User        string
+	Files       map[string]string // file name to content as of the revision
+	Additions   int
+	Deletions   int
+	CommittedAt time.Time
+}
+
+// Comment is a comment on a gist
+type Comment struct {
+	ID        int64
+	User      string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Failure makes the fake reply with an error instead of serving requests
+type Failure struct {
+	Method string      // method to fail, or any method if empty
+	Path   string      // path prefix to fail (e.g. /gists), or any path if empty
+	Status int         // status of the reply
+	Body   string      // body of the reply, defaults to a GitHub style message
+	Header http.Header // extra headers of the reply
+	Times  int         // number of requests to fail, once if zero, always if negative
+}
+
+// Request is a request served by the fake, as recorded in its log
+type Request struct {
+	Method string
+	Path   string // path and query
+	Login  string // authenticated user, if any
+	Status int
+}
+
+// Server is the fake API, listening on a local address. Create one with
+// NewServer. Its methods are safe for concurrent use.
+type Server struct {
+	URL string // root of the fake API, used in place of https://api.github.com
+
+	server *httptest.Server
+
+	mu         sync.Mutex
+	tokens     map[string]*token
+	gists      map[string]*Gist
+	failures   []*Failure
+	requests   []*Request
+	sequence   int64
+	rateLimit  int
+	rateUsed   int
+	rateReset  time.Time
+	truncateAt int
+	now        func() time.Time
+}
+
+// token is a credential accepted by the fake
+type token struct {
+	login  string
+	scopes []string
+}
+
+// NewServer starts and returns a new fake. The caller should call Close when
+// finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		tokens:    make(map[string]*token),
+		gists:     make(map[string]*Gist),
+		rateLimit: 5000,
+		now:       time.Now,
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the fake and blocks until all outstanding requests have
+// completed
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns an HTTP client configured for the fake
+func (s *Server) Client() *http.Client {
+	return s.server.Client()
+}
+
+// AddToken accepts a token for the login. Without scopes, the token has the
+// gist scope. Tokens without it can read but not write, as on GitHub.
+func (s *Server) AddToken(value, login string, scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(scopes) == 0 {
+		scopes = []string{"gist"}
+	}
+	s.tokens[value] = &token{login: login, scopes: scopes}
+}
+
+// SetRateLimit sets the number of requests allowed until the reset, and
+// restores the remaining requests to that limit. Once exhausted, requests are
+// rejected with 403 until Reset.
+func (s *Server) SetRateLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit, s.rateUsed = limit, 0
+}
+
+// Reset restores the remaining requests of the rate limit
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateUsed = 0
+}
+
+// SetClock makes the fake read the time from now, for the creation and update
+// times of gists and comments, and the rate limit reset. Nil restores the
+// system clock.
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now == nil {
+		now = time.Now
+	}
+	s.now = now
+}
+
+// SetTruncate makes the fake truncate file content longer than n bytes when
+// replying with a single gist, as GitHub does for large files. The full
+// content is served from the file's raw_url. Zero disables truncation.
+func (s *Server) SetTruncate(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncateAt = n
+}
+
+// Fail makes the fake fail the requests matching the failure, before any
+// other processing (including authentication). Failures are matched in the
+// order they were added.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	s.failures = append(s.failures, &f)
+}
+
+// AddGist stores a gist owned by login, as if it had been created through the
+// API, and returns a copy of it
+func (s *Server) AddGist(login, description string, public bool, files map[string]string) *Gist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(login, description, public, files, "").copy()
+}
+
+// Gist returns a copy of the gist with the ID, if it exists
+func (s *Server) Gist(id string) (*Gist, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.gists[id]
+	if !ok {
+		return nil, false
+	}
+	return g.copy(), true
+}
+
+// Gists returns copies of every stored gist, most recently created first
+func (s *Server) Gists() []*Gist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gists := make([]*Gist, 0, len(s.gists))
+	for _, g := range s.sorted(func(*Gist) bool { return true }) {
+		gists = append(gists, g.copy())
+	}
+	return gists
+}
+
+// Requests returns the log of requests served by the fake, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]Request, len(s.requests))
+	for i, r := range s.requests {
+		requests[i] = *r
+	}
+	return requests
+}
+
+// copy returns a deep copy of the gist, so callers cannot alter the fake's
+// state
+func (g *Gist) copy() *Gist {
+	c := *g
+	c.Files = copyFiles(g.Files)
+	c.Stars = make(map[string]bool)
+	for login := range g.Stars {
+		c.Stars[login] = true
+	}
+	c.History = make([]*Revision, len(g.History))
+	for i, r := range g.History {
+		revision := *r
+		revision.Files = copyFiles(r.Files)
+		c.History[i] = &revision
+	}
+	c.Comments = make([]*Comment, len(g.Comments))
+	for i, comment := range g.Comments {
+		copied := *comment
+		c.Comments[i] = &copied
+	}
+	return &c
+}
+
+// copyFiles returns a copy of a file name to content map
+func copyFiles(files map[string]string) map[string]string {
+	c := make(map[string]string, len(files))
+	for name, content := range files {
+		c[name] = content
+	}
+	return c
+}
+
+// newID returns a unique hex ID of n characters, derived from a sequence so
+// runs are reproducible
+func (s *Server) newID(n int) string {
+	s.sequence++
+	sum := sha1.Sum([]byte(fmt.Sprintf("gisttest-%d", s.sequence)))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+// create stores a new gist with its first revision. The caller holds the lock.
+func (s *Server) create(login, description string, public bool, files map[string]string, forkOf string) *Gist {
+	now := s.now().UTC().Truncate(time.Second)
+	g := &Gist{
+		ID:          s.newID(32),
+		Owner:       login,
+		Description: description,
+		Public:      public,
+		Files:       copyFiles(files),
+		Stars:       make(map[string]bool),
+		ForkOf:      forkOf,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		order:       s.sequence,
+	}
+	s.commit(g, login, nil)
+	s.gists[g.ID] = g
+	return g
+}
+
+// commit records the gist's files as a new revision. The caller holds the lock.
+func (s *Server) commit(g *Gist, login string, previous map[string]string) {
+	additions, deletions := 0, 0
+	names := make(map[string]bool)
+	for name := range previous {
+		names[name] = true
+	}
+	for name := range g.Files {
+		names[name] = true
+	}
+	for name := range names {
+		added, deleted := lineChanges(previous[name], g.Files[name])
+		additions += added
+		deletions += deleted
+	}
+	g.History = append([]*Revision{{
+		Version:     s.newID(40),
+		User:        login,
+		Files:       copyFiles(g.Files),
+		Additions:   additions,
+		Deletions:   deletions,
+		CommittedAt: g.UpdatedAt,
+	}}, g.History...)
+}
+
+// lineChanges counts the lines added and deleted between two versions of a
+// file, ignoring their order
+func lineChanges(before, after string) (int, int) {
+	lines := make(map[string]int)
+	if before != "" {
+		for _, line := range strings.Split(before, "\n") {
+			lines[line]--
+		}
+	}
+	if after != "" {
+		for _, line := range strings.Split(after, "\n") {
+			lines[line]++
+		}
+	}
+	added, deleted := 0, 0
+	for _, count := range lines {
+		if count > 0 {
+			added += count
+		} else {
+			deleted -= count
+		}
+	}
+	return added, deleted
+}
+
+// sorted returns the gists matching keep, most recently created first. The
+// caller holds the lock.
+func (s *Server) sorted(keep func(*Gist) bool) []*Gist {
+	var gists []*Gist
+	for _, g := range s.gists {
+		if keep(g) {
+			gists = append(gists, g)
+		}
+	}
+	sort.Slice(gists, func(i, j int) bool {
+		return gists[i].order > gists[j].order
+	})
+	return gists
+}
@@ -0,0 +1,385 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gisttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// send makes a request to the fake with the token, encoding in as JSON, and
+// decodes the reply into out when given. It returns the response, whose body
+// has been read.
+func send(t *testing.T, srv *Server, method, path, token string, in, out interface{}) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, srv.URL+path, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(contents, out); err != nil {
+			t.Fatalf("%s %s: cannot decode %q: %s", method, path, contents, err)
+		}
+	}
+	return resp
+}
+
+// apiGist is the part of a gist reply the tests read
+type apiGist struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	Files       map[string]*struct {
+		Content   string `json:"content"`
+		RawURL    string `json:"raw_url"`
+		Truncated bool   `json:"truncated"`
+	} `json:"files"`
+	History []struct {
+		Version string `json:"version"`
+	} `json:"history"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// files builds the files of a create or update request
+func files(contents map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"files": contents}
+}
+
+func TestCreateGetUpdateDelete(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+
+	var created apiGist
+	resp := send(t, srv, "POST", "/gists", "tok", map[string]interface{}{
+		"description": "notes",
+		"public":      false,
+		"files": map[string]interface{}{
+			"a.txt": map[string]string{"content": "alpha"},
+			"b.txt": map[string]string{"content": "beta"},
+		},
+	}, &created)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create replied %d", resp.StatusCode)
+	}
+	if created.Description != "notes" || created.Public || len(created.Files) != 2 || len(created.History) != 1 {
+		t.Fatalf("created gist %+v", created)
+	}
+
+	var got apiGist
+	send(t, srv, "GET", "/gists/"+created.ID, "", nil, &got)
+	if got.Files["a.txt"] == nil || got.Files["a.txt"].Content != "alpha" {
+		t.Fatalf("fetched files %+v", got.Files)
+	}
+
+	// rename a.txt, delete b.txt and add c.txt
+	var updated apiGist
+	resp = send(t, srv, "PATCH", "/gists/"+created.ID, "tok", files(map[string]interface{}{
+		"a.txt": map[string]string{"filename": "renamed.txt"},
+		"b.txt": nil,
+		"c.txt": map[string]string{"content": "gamma"},
+	}), &updated)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update replied %d", resp.StatusCode)
+	}
+	g, ok := srv.Gist(created.ID)
+	if !ok {
+		t.Fatal("updated gist is missing")
+	}
+	want := map[string]string{"renamed.txt": "alpha", "c.txt": "gamma"}
+	if len(g.Files) != len(want) || g.Files["renamed.txt"] != "alpha" || g.Files["c.txt"] != "gamma" {
+		t.Fatalf("files after update %v, want %v", g.Files, want)
+	}
+	if len(g.History) != 2 || len(updated.History) != 2 {
+		t.Fatalf("history has %d revisions, want 2", len(g.History))
+	}
+
+	// the first revision is still served
+	var old apiGist
+	send(t, srv, "GET", "/gists/"+created.ID+"/"+g.History[1].Version, "", nil, &old)
+	if old.Files["b.txt"] == nil || old.Files["b.txt"].Content != "beta" {
+		t.Fatalf("old revision files %+v", old.Files)
+	}
+
+	if resp := send(t, srv, "DELETE", "/gists/"+created.ID, "tok", nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete replied %d", resp.StatusCode)
+	}
+	if resp := send(t, srv, "GET", "/gists/"+created.ID, "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("get after delete replied %d", resp.StatusCode)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+
+	resp := send(t, srv, "POST", "/gists", "tok", files(map[string]interface{}{
+		"blank.txt": map[string]string{"content": "  \n"},
+	}), nil)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("blank file replied %d, want 422", resp.StatusCode)
+	}
+
+	g := srv.AddGist("octocat", "", true, map[string]string{"only.txt": "x"})
+	resp = send(t, srv, "PATCH", "/gists/"+g.ID, "tok", files(map[string]interface{}{"only.txt": nil}), nil)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("deleting the last file replied %d, want 422", resp.StatusCode)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+	srv.AddToken("read", "octocat", "repo")
+	srv.AddToken("other", "hubot")
+	mine := srv.AddGist("octocat", "mine", false, map[string]string{"a.txt": "a"})
+	srv.AddGist("hubot", "public", true, map[string]string{"b.txt": "b"})
+
+	create := files(map[string]interface{}{"a.txt": map[string]string{"content": "a"}})
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		in     interface{}
+		status int
+	}{
+		{"bad token", "GET", "/gists", "wrong", nil, http.StatusUnauthorized},
+		{"anonymous create", "POST", "/gists", "", create, http.StatusUnauthorized},
+		{"missing scope", "POST", "/gists", "read", create, http.StatusNotFound},
+		{"other owner", "PATCH", "/gists/" + mine.ID, "other", create, http.StatusNotFound},
+		{"other owner delete", "DELETE", "/gists/" + mine.ID, "other", nil, http.StatusNotFound},
+		{"owner", "POST", "/gists", "tok", create, http.StatusCreated},
+	}
+	for _, tc := range cases {
+		if resp := send(t, srv, tc.method, tc.path, tc.token, tc.in, nil); resp.StatusCode != tc.status {
+			t.Errorf("%s: replied %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+
+	// anonymous listings only hold public gists
+	var listed []apiGist
+	send(t, srv, "GET", "/gists", "", nil, &listed)
+	if len(listed) != 1 || listed[0].Description != "public" {
+		t.Fatalf("anonymous listing %+v", listed)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+	for i := 0; i < 5; i++ {
+		srv.AddGist("octocat", strings.Repeat("x", i+1), true, map[string]string{"a.txt": "a"})
+	}
+
+	var seen []string
+	path := "/gists?per_page=2"
+	for pages := 0; path != ""; pages++ {
+		if pages == 5 {
+			t.Fatal("pagination does not end")
+		}
+		var page []apiGist
+		resp := send(t, srv, "GET", path, "tok", nil, &page)
+		for _, g := range page {
+			seen = append(seen, g.Description)
+		}
+		path = ""
+		for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+			if strings.Contains(link, `rel="next"`) {
+				next := strings.TrimSpace(link)
+				next = next[1:strings.Index(next, ">")]
+				path = strings.TrimPrefix(next, srv.URL)
+			}
+		}
+	}
+	// most recently created first
+	want := []string{"xxxxx", "xxxx", "xxx", "xx", "x"}
+	if strings.Join(seen, " ") != strings.Join(want, " ") {
+		t.Fatalf("listed %v, want %v", seen, want)
+	}
+}
+
+func TestETag(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	g := srv.AddGist("octocat", "", true, map[string]string{"a.txt": "a"})
+
+	resp := send(t, srv, "GET", "/gists/"+g.ID, "", nil, nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	req, _ := http.NewRequest("GET", srv.URL+"/gists/"+g.ID, nil)
+	req.Header.Set("If-None-Match", etag)
+	cached, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.Body.Close()
+	if cached.StatusCode != http.StatusNotModified {
+		t.Fatalf("conditional request replied %d, want 304", cached.StatusCode)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+	srv.Fail(Failure{Method: "POST", Path: "/gists", Status: http.StatusBadGateway, Times: 2})
+
+	create := files(map[string]interface{}{"a.txt": map[string]string{"content": "a"}})
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		statuses = append(statuses, send(t, srv, "POST", "/gists", "tok", create, nil).StatusCode)
+	}
+	// reads are not affected
+	statuses = append(statuses, send(t, srv, "GET", "/gists", "tok", nil, nil).StatusCode)
+
+	want := []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusCreated, http.StatusOK}
+	requests := srv.Requests()
+	if len(requests) != len(want) {
+		t.Fatalf("logged %d requests, want %d", len(requests), len(want))
+	}
+	for i := range want {
+		if statuses[i] != want[i] || requests[i].Status != want[i] {
+			t.Errorf("request %d replied %d and logged %d, want %d", i, statuses[i], requests[i].Status, want[i])
+		}
+	}
+	if len(srv.Gists()) != 1 {
+		t.Fatalf("stored %d gists, want 1", len(srv.Gists()))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	srv.SetClock(func() time.Time { return now })
+	srv.SetRateLimit(2)
+
+	for i := 0; i < 2; i++ {
+		if resp := send(t, srv, "GET", "/gists", "", nil, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d replied %d", i, resp.StatusCode)
+		}
+	}
+	resp := send(t, srv, "GET", "/gists", "", nil, nil)
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("exhausted limit replied %d with %s remaining", resp.StatusCode, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	// the limit resets an hour later
+	now = now.Add(time.Hour + time.Second)
+	if resp := send(t, srv, "GET", "/gists", "", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("request after the reset replied %d", resp.StatusCode)
+	}
+}
+
+func TestClock(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	srv.SetClock(func() time.Time { return now })
+
+	var created apiGist
+	send(t, srv, "POST", "/gists", "tok", files(map[string]interface{}{
+		"a.txt": map[string]string{"content": "a"},
+	}), &created)
+	if !created.CreatedAt.Equal(now) {
+		t.Fatalf("created at %s, want %s", created.CreatedAt, now)
+	}
+
+	now = now.Add(48 * time.Hour)
+	send(t, srv, "PATCH", "/gists/"+created.ID, "tok", files(map[string]interface{}{
+		"a.txt": map[string]string{"content": "b"},
+	}), nil)
+	g, _ := srv.Gist(created.ID)
+	if !g.UpdatedAt.Equal(now) || !g.History[0].CommittedAt.Equal(now) {
+		t.Fatalf("updated at %s, want %s", g.UpdatedAt, now)
+	}
+
+	// only gists updated since the time are listed
+	var listed []apiGist
+	send(t, srv, "GET", "/gists?since="+now.Add(-time.Hour).Format(time.RFC3339), "tok", nil, &listed)
+	if len(listed) != 1 {
+		t.Fatalf("listed %d gists updated since, want 1", len(listed))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetTruncate(4)
+	g := srv.AddGist("octocat", "", true, map[string]string{"long.txt": "0123456789"})
+
+	var got apiGist
+	send(t, srv, "GET", "/gists/"+g.ID, "", nil, &got)
+	f := got.Files["long.txt"]
+	if f == nil || !f.Truncated || f.Content != "0123" {
+		t.Fatalf("truncated file %+v", f)
+	}
+
+	resp, err := srv.Client().Get(f.RawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := ioutil.ReadAll(resp.Body)
+	if string(raw) != "0123456789" {
+		t.Fatalf("raw content %q", raw)
+	}
+}
+
+func TestStarsAndForks(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddToken("tok", "octocat")
+	srv.AddToken("other", "hubot")
+	g := srv.AddGist("hubot", "shared", true, map[string]string{"a.txt": "a"})
+
+	if resp := send(t, srv, "PUT", "/gists/"+g.ID+"/star", "tok", nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("star replied %d", resp.StatusCode)
+	}
+	var starred []apiGist
+	send(t, srv, "GET", "/gists/starred", "tok", nil, &starred)
+	if len(starred) != 1 || starred[0].ID != g.ID {
+		t.Fatalf("starred %+v", starred)
+	}
+
+	if resp := send(t, srv, "POST", "/gists/"+g.ID+"/forks", "other", nil, nil); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("forking your own gist replied %d, want 422", resp.StatusCode)
+	}
+	var fork apiGist
+	send(t, srv, "POST", "/gists/"+g.ID+"/forks", "tok", nil, &fork)
+	if stored, ok := srv.Gist(fork.ID); !ok || stored.ForkOf != g.ID || stored.Owner != "octocat" {
+		t.Fatalf("fork %+v", stored)
+	}
+}